@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// aliases maps a name to the command lines it runs. The arguments given to
+// an alias are appended to a line that doesn't use any of them, lines of a
+// macro can instead refer to them as $1, $2... or $@ for all of them, e.g.
+// "hunt" -> ["explore $1", "catch $2"].
+type aliases map[string][]string
+
+// maxAliasDepth bounds how deeply aliases may refer to other aliases.
+const maxAliasDepth = 10
+
+// loadAliases reads the aliases saved at path. Entries that alias add
+// wouldn't accept are left out and reported in the returned error, next to
+// the aliases that could be loaded.
+func loadAliases(path string) (aliases, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return aliases{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	stored := map[string][]string{}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("reading aliases from %s: %w", path, err)
+	}
+	names := make([]string, 0, len(stored))
+	for name := range stored {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	loaded := aliases{}
+	errs := []error{}
+	for _, name := range names {
+		normalized, lines, err := normalizeAlias(name, stored[name])
+		if err == nil {
+			if _, ok := loaded[normalized]; ok {
+				err = fmt.Errorf("%s is defined twice", normalized)
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ignoring alias %q in %s: %w", name, path, err))
+			continue
+		}
+		loaded[normalized] = lines
+	}
+	return loaded, errors.Join(errs...)
+}
+
+func (a aliases) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// names returns the alias names in alphabetical order.
+func (a aliases) names() []string {
+	names := make([]string, 0, len(a))
+	for name := range a {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// expand resolves words, a command name and its arguments, into the
+// commands to run.
+func (a aliases) expand(words []string) ([][]string, error) {
+	return a.expandDepth(words, 0)
+}
+
+func (a aliases) expandDepth(words []string, depth int) ([][]string, error) {
+	lines, ok := a[words[0]]
+	if !ok {
+		return [][]string{words}, nil
+	}
+	if depth >= maxAliasDepth {
+		return nil, fmt.Errorf("alias %s refers to aliases more than %d deep, is it calling itself?", words[0], maxAliasDepth)
+	}
+	expanded := [][]string{}
+	for _, line := range lines {
+		substituted, err := substitute(words[0], strings.Fields(line), words[1:])
+		if err != nil {
+			return nil, err
+		}
+		if len(substituted) == 0 {
+			continue
+		}
+		commands, err := a.expandDepth(substituted, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, commands...)
+	}
+	return expanded, nil
+}
+
+// substitute replaces $1, $2... and $@ in template with args, appending args
+// if template refers to none of them.
+func substitute(name string, template, args []string) ([]string, error) {
+	words := []string{}
+	used := false
+	for _, word := range template {
+		if word == "$@" {
+			words = append(words, args...)
+			used = true
+			continue
+		}
+		if !strings.HasPrefix(word, "$") {
+			words = append(words, word)
+			continue
+		}
+		n, err := strconv.Atoi(word[1:])
+		if err != nil || n < 1 {
+			words = append(words, word)
+			continue
+		}
+		if n > len(args) {
+			return nil, fmt.Errorf("alias %s is missing argument $%d", name, n)
+		}
+		words = append(words, args[n-1])
+		used = true
+	}
+	if !used {
+		words = append(words, args...)
+	}
+	return words, nil
+}
+
+// add defines name to run the commands in definition, separated by ";".
+func (a aliases) add(name, definition string) error {
+	name, lines, err := normalizeAlias(name, strings.Split(definition, ";"))
+	if err != nil {
+		return err
+	}
+	a[name] = lines
+	return nil
+}
+
+// normalizeAlias lower cases name and lines, like all input is, and checks
+// that they make a usable alias.
+func normalizeAlias(name string, lines []string) (string, []string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || len(strings.Fields(name)) != 1 {
+		return "", nil, fmt.Errorf("%q is not a single word", name)
+	}
+	if _, ok := getCommands()[name]; ok {
+		return "", nil, fmt.Errorf("%s is already a command", name)
+	}
+	normalized := []string{}
+	for _, line := range lines {
+		if line = strings.ToLower(strings.TrimSpace(line)); line != "" {
+			normalized = append(normalized, line)
+		}
+	}
+	if len(normalized) == 0 {
+		return "", nil, fmt.Errorf("alias %s has no commands", name)
+	}
+	return name, normalized, nil
+}
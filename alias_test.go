@@ -0,0 +1,131 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAliasesExpand(t *testing.T) {
+	defined := aliases{
+		"c":     {"catch"},
+		"hunt":  {"explore $1", "catch $2"},
+		"twice": {"c $1", "c $1"},
+		"all":   {"catch $@"},
+		"loop":  {"loop"},
+	}
+	cases := []struct {
+		input    []string
+		expected [][]string
+		err      bool
+	}{
+		{
+			input:    []string{"map"},
+			expected: [][]string{{"map"}},
+		},
+		{
+			input:    []string{"c", "pikachu"},
+			expected: [][]string{{"catch", "pikachu"}},
+		},
+		{
+			input:    []string{"hunt", "canalave-city", "pikachu"},
+			expected: [][]string{{"explore", "canalave-city"}, {"catch", "pikachu"}},
+		},
+		{
+			input:    []string{"twice", "ditto"},
+			expected: [][]string{{"catch", "ditto"}, {"catch", "ditto"}},
+		},
+		{
+			input:    []string{"all", "ditto", "mew"},
+			expected: [][]string{{"catch", "ditto", "mew"}},
+		},
+		{
+			input: []string{"hunt", "canalave-city"},
+			err:   true,
+		},
+		{
+			input: []string{"loop"},
+			err:   true,
+		},
+	}
+	for _, cs := range cases {
+		actual, err := defined.expand(cs.input)
+		if cs.err {
+			if err == nil {
+				t.Errorf("%v: expected an error", cs.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", cs.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, cs.expected) {
+			t.Errorf("%v does not equal %v", actual, cs.expected)
+		}
+	}
+}
+
+func TestAliasesAdd(t *testing.T) {
+	defined := aliases{}
+	if err := defined.add("hunt", "explore $1; catch $2;"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(defined["hunt"], []string{"explore $1", "catch $2"}) {
+		t.Errorf("unexpected alias %v", defined["hunt"])
+	}
+	if err := defined.add("catch", "inspect"); err == nil {
+		t.Error("expected commands not to be redefined")
+	}
+	if err := defined.add("empty", " ; "); err == nil {
+		t.Error("expected an alias without commands to be rejected")
+	}
+}
+
+func TestAliasesPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pokedex", "aliases.json")
+	loaded, err := loadAliases(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 0 {
+		t.Errorf("expected no aliases, got %v", loaded)
+	}
+	defined := aliases{"c": {"catch"}, "hunt": {"explore $1", "catch $2"}}
+	if err := defined.save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err = loadAliases(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, defined) {
+		t.Errorf("%v does not equal %v", loaded, defined)
+	}
+}
+
+func TestLoadAliasesChecksEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aliases.json")
+	file := `{
+  "C": ["Catch"],
+  "map": ["explore $1"],
+  "empty": [" "],
+  "i": ["inspect"]
+}`
+	if err := os.WriteFile(path, []byte(file), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadAliases(path)
+	if err == nil {
+		t.Error("expected the invalid entries to be reported")
+	}
+	expected := aliases{"c": {"catch"}, "i": {"inspect"}}
+	if !reflect.DeepEqual(loaded, expected) {
+		t.Errorf("%v does not equal %v", loaded, expected)
+	}
+	commands, err := loaded.expand([]string{"map"})
+	if err != nil || !reflect.DeepEqual(commands, [][]string{{"map"}}) {
+		t.Errorf("map should still run the command, got %v, %v", commands, err)
+	}
+}
@@ -0,0 +1,869 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cache "github.com/cristhianjhlcom/pokedex/internal"
+)
+
+const defaultBaseURL = "https://pokeapi.co/api/v2"
+
+const (
+	// list pages shift whenever PokeAPI adds resources, individual
+	// resources practically never change.
+	locationListTTL = 10 * time.Minute
+	resourceTTL     = 24 * time.Hour
+	// expired responses are kept this long so they can be revalidated
+	// instead of downloaded again.
+	staleRetention = 7 * 24 * time.Hour
+)
+
+type Pokemon struct {
+	Abilities []struct {
+		Ability struct {
+			Name string `json:"name"`
+			URL  string `json:"url"`
+		} `json:"ability"`
+		IsHidden bool `json:"is_hidden"`
+		Slot     int  `json:"slot"`
+	} `json:"abilities"`
+	BaseExperience int `json:"base_experience"`
+	Cries          struct {
+		Latest string `json:"latest"`
+		Legacy string `json:"legacy"`
+	} `json:"cries"`
+	Forms []struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	} `json:"forms"`
+	GameIndices []struct {
+		GameIndex int `json:"game_index"`
+		Version   struct {
+			Name string `json:"name"`
+			URL  string `json:"url"`
+		} `json:"version"`
+	} `json:"game_indices"`
+	Height                 int           `json:"height"`
+	HeldItems              []interface{} `json:"held_items"`
+	ID                     int           `json:"id"`
+	IsDefault              bool          `json:"is_default"`
+	LocationAreaEncounters string        `json:"location_area_encounters"`
+	Moves                  []struct {
+		Move struct {
+			Name string `json:"name"`
+			URL  string `json:"url"`
+		} `json:"move"`
+		VersionGroupDetails []struct {
+			LevelLearnedAt  int `json:"level_learned_at"`
+			MoveLearnMethod struct {
+				Name string `json:"name"`
+				URL  string `json:"url"`
+			} `json:"move_learn_method"`
+			VersionGroup struct {
+				Name string `json:"name"`
+				URL  string `json:"url"`
+			} `json:"version_group"`
+		} `json:"version_group_details"`
+	} `json:"moves"`
+	Name          string        `json:"name"`
+	Order         int           `json:"order"`
+	PastAbilities []interface{} `json:"past_abilities"`
+	PastTypes     []interface{} `json:"past_types"`
+	Species       struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	} `json:"species"`
+	Sprites struct {
+		BackDefault      string      `json:"back_default"`
+		BackFemale       interface{} `json:"back_female"`
+		BackShiny        string      `json:"back_shiny"`
+		BackShinyFemale  interface{} `json:"back_shiny_female"`
+		FrontDefault     string      `json:"front_default"`
+		FrontFemale      interface{} `json:"front_female"`
+		FrontShiny       string      `json:"front_shiny"`
+		FrontShinyFemale interface{} `json:"front_shiny_female"`
+		Other            struct {
+			DreamWorld struct {
+				FrontDefault string      `json:"front_default"`
+				FrontFemale  interface{} `json:"front_female"`
+			} `json:"dream_world"`
+			Home struct {
+				FrontDefault     string      `json:"front_default"`
+				FrontFemale      interface{} `json:"front_female"`
+				FrontShiny       string      `json:"front_shiny"`
+				FrontShinyFemale interface{} `json:"front_shiny_female"`
+			} `json:"home"`
+			OfficialArtwork struct {
+				FrontDefault string `json:"front_default"`
+				FrontShiny   string `json:"front_shiny"`
+			} `json:"official-artwork"`
+			Showdown struct {
+				BackDefault      string      `json:"back_default"`
+				BackFemale       interface{} `json:"back_female"`
+				BackShiny        string      `json:"back_shiny"`
+				BackShinyFemale  interface{} `json:"back_shiny_female"`
+				FrontDefault     string      `json:"front_default"`
+				FrontFemale      interface{} `json:"front_female"`
+				FrontShiny       string      `json:"front_shiny"`
+				FrontShinyFemale interface{} `json:"front_shiny_female"`
+			} `json:"showdown"`
+		} `json:"other"`
+		Versions struct {
+			GenerationI struct {
+				RedBlue struct {
+					BackDefault      string `json:"back_default"`
+					BackGray         string `json:"back_gray"`
+					BackTransparent  string `json:"back_transparent"`
+					FrontDefault     string `json:"front_default"`
+					FrontGray        string `json:"front_gray"`
+					FrontTransparent string `json:"front_transparent"`
+				} `json:"red-blue"`
+				Yellow struct {
+					BackDefault      string `json:"back_default"`
+					BackGray         string `json:"back_gray"`
+					BackTransparent  string `json:"back_transparent"`
+					FrontDefault     string `json:"front_default"`
+					FrontGray        string `json:"front_gray"`
+					FrontTransparent string `json:"front_transparent"`
+				} `json:"yellow"`
+			} `json:"generation-i"`
+			GenerationIi struct {
+				Crystal struct {
+					BackDefault           string `json:"back_default"`
+					BackShiny             string `json:"back_shiny"`
+					BackShinyTransparent  string `json:"back_shiny_transparent"`
+					BackTransparent       string `json:"back_transparent"`
+					FrontDefault          string `json:"front_default"`
+					FrontShiny            string `json:"front_shiny"`
+					FrontShinyTransparent string `json:"front_shiny_transparent"`
+					FrontTransparent      string `json:"front_transparent"`
+				} `json:"crystal"`
+				Gold struct {
+					BackDefault      string `json:"back_default"`
+					BackShiny        string `json:"back_shiny"`
+					FrontDefault     string `json:"front_default"`
+					FrontShiny       string `json:"front_shiny"`
+					FrontTransparent string `json:"front_transparent"`
+				} `json:"gold"`
+				Silver struct {
+					BackDefault      string `json:"back_default"`
+					BackShiny        string `json:"back_shiny"`
+					FrontDefault     string `json:"front_default"`
+					FrontShiny       string `json:"front_shiny"`
+					FrontTransparent string `json:"front_transparent"`
+				} `json:"silver"`
+			} `json:"generation-ii"`
+			GenerationIii struct {
+				Emerald struct {
+					FrontDefault string `json:"front_default"`
+					FrontShiny   string `json:"front_shiny"`
+				} `json:"emerald"`
+				FireredLeafgreen struct {
+					BackDefault  string `json:"back_default"`
+					BackShiny    string `json:"back_shiny"`
+					FrontDefault string `json:"front_default"`
+					FrontShiny   string `json:"front_shiny"`
+				} `json:"firered-leafgreen"`
+				RubySapphire struct {
+					BackDefault  string `json:"back_default"`
+					BackShiny    string `json:"back_shiny"`
+					FrontDefault string `json:"front_default"`
+					FrontShiny   string `json:"front_shiny"`
+				} `json:"ruby-sapphire"`
+			} `json:"generation-iii"`
+			GenerationIv struct {
+				DiamondPearl struct {
+					BackDefault      string      `json:"back_default"`
+					BackFemale       interface{} `json:"back_female"`
+					BackShiny        string      `json:"back_shiny"`
+					BackShinyFemale  interface{} `json:"back_shiny_female"`
+					FrontDefault     string      `json:"front_default"`
+					FrontFemale      interface{} `json:"front_female"`
+					FrontShiny       string      `json:"front_shiny"`
+					FrontShinyFemale interface{} `json:"front_shiny_female"`
+				} `json:"diamond-pearl"`
+				HeartgoldSoulsilver struct {
+					BackDefault      string      `json:"back_default"`
+					BackFemale       interface{} `json:"back_female"`
+					BackShiny        string      `json:"back_shiny"`
+					BackShinyFemale  interface{} `json:"back_shiny_female"`
+					FrontDefault     string      `json:"front_default"`
+					FrontFemale      interface{} `json:"front_female"`
+					FrontShiny       string      `json:"front_shiny"`
+					FrontShinyFemale interface{} `json:"front_shiny_female"`
+				} `json:"heartgold-soulsilver"`
+				Platinum struct {
+					BackDefault      string      `json:"back_default"`
+					BackFemale       interface{} `json:"back_female"`
+					BackShiny        string      `json:"back_shiny"`
+					BackShinyFemale  interface{} `json:"back_shiny_female"`
+					FrontDefault     string      `json:"front_default"`
+					FrontFemale      interface{} `json:"front_female"`
+					FrontShiny       string      `json:"front_shiny"`
+					FrontShinyFemale interface{} `json:"front_shiny_female"`
+				} `json:"platinum"`
+			} `json:"generation-iv"`
+			GenerationV struct {
+				BlackWhite struct {
+					Animated struct {
+						BackDefault      string      `json:"back_default"`
+						BackFemale       interface{} `json:"back_female"`
+						BackShiny        string      `json:"back_shiny"`
+						BackShinyFemale  interface{} `json:"back_shiny_female"`
+						FrontDefault     string      `json:"front_default"`
+						FrontFemale      interface{} `json:"front_female"`
+						FrontShiny       string      `json:"front_shiny"`
+						FrontShinyFemale interface{} `json:"front_shiny_female"`
+					} `json:"animated"`
+					BackDefault      string      `json:"back_default"`
+					BackFemale       interface{} `json:"back_female"`
+					BackShiny        string      `json:"back_shiny"`
+					BackShinyFemale  interface{} `json:"back_shiny_female"`
+					FrontDefault     string      `json:"front_default"`
+					FrontFemale      interface{} `json:"front_female"`
+					FrontShiny       string      `json:"front_shiny"`
+					FrontShinyFemale interface{} `json:"front_shiny_female"`
+				} `json:"black-white"`
+			} `json:"generation-v"`
+			GenerationVi struct {
+				OmegarubyAlphasapphire struct {
+					FrontDefault     string      `json:"front_default"`
+					FrontFemale      interface{} `json:"front_female"`
+					FrontShiny       string      `json:"front_shiny"`
+					FrontShinyFemale interface{} `json:"front_shiny_female"`
+				} `json:"omegaruby-alphasapphire"`
+				XY struct {
+					FrontDefault     string      `json:"front_default"`
+					FrontFemale      interface{} `json:"front_female"`
+					FrontShiny       string      `json:"front_shiny"`
+					FrontShinyFemale interface{} `json:"front_shiny_female"`
+				} `json:"x-y"`
+			} `json:"generation-vi"`
+			GenerationVii struct {
+				Icons struct {
+					FrontDefault string      `json:"front_default"`
+					FrontFemale  interface{} `json:"front_female"`
+				} `json:"icons"`
+				UltraSunUltraMoon struct {
+					FrontDefault     string      `json:"front_default"`
+					FrontFemale      interface{} `json:"front_female"`
+					FrontShiny       string      `json:"front_shiny"`
+					FrontShinyFemale interface{} `json:"front_shiny_female"`
+				} `json:"ultra-sun-ultra-moon"`
+			} `json:"generation-vii"`
+			GenerationViii struct {
+				Icons struct {
+					FrontDefault string      `json:"front_default"`
+					FrontFemale  interface{} `json:"front_female"`
+				} `json:"icons"`
+			} `json:"generation-viii"`
+		} `json:"versions"`
+	} `json:"sprites"`
+	Stats []struct {
+		BaseStat int `json:"base_stat"`
+		Effort   int `json:"effort"`
+		Stat     struct {
+			Name string `json:"name"`
+			URL  string `json:"url"`
+		} `json:"stat"`
+	} `json:"stats"`
+	Types []struct {
+		Slot int `json:"slot"`
+		Type struct {
+			Name string `json:"name"`
+			URL  string `json:"url"`
+		} `json:"type"`
+	} `json:"types"`
+	Weight int `json:"weight"`
+}
+
+type Client struct {
+	baseURL              string
+	cache                cache.Cache
+	httpClient           http.Client
+	inflight             *flightGroup
+	offline              bool
+	staleWhileRevalidate bool
+	maxRetries           int
+	retryDelay           time.Duration
+	maxRetryDelay        time.Duration
+	limiter              *rateLimiter
+	stats                *clientStats
+}
+
+type clientStats struct {
+	requests      atomic.Int64
+	retries       atomic.Int64
+	throttled     atomic.Int64
+	throttledTime atomic.Int64
+}
+
+type ClientStats struct {
+	Requests int64
+	Retries  int64
+	// Throttled counts the requests the rate limiter held back, for a
+	// total of ThrottledTime.
+	Throttled     int64
+	ThrottledTime time.Duration
+}
+
+type LocationAreaResponse struct {
+	Count    int     `json:"count"`
+	Next     *string `json:"next"`
+	Previous *string `json:"previous"`
+	Results  []struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	} `json:"results"`
+}
+
+type LocationArea struct {
+	Areas []struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	} `json:"areas"`
+	GameIndices []struct {
+		GameIndex  int `json:"game_index"`
+		Generation struct {
+			Name string `json:"name"`
+			URL  string `json:"url"`
+		} `json:"generation"`
+	} `json:"game_indices"`
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Names []struct {
+		Language struct {
+			Name string `json:"name"`
+			URL  string `json:"url"`
+		} `json:"language"`
+		Name string `json:"name"`
+	} `json:"names"`
+	Region struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	} `json:"region"`
+}
+
+type clientSettings struct {
+	baseURL              string
+	timeout              time.Duration
+	transport            http.RoundTripper
+	cache                cache.Cache
+	cacheInterval        time.Duration
+	cacheOptions         []cache.Option
+	offline              bool
+	staleWhileRevalidate bool
+	maxRetries           int
+	retryDelay           time.Duration
+	maxRetryDelay        time.Duration
+	rateLimit            float64
+	rateBurst            int
+}
+
+type ClientOption func(*clientSettings)
+
+// WithBaseURL points the client at another PokeAPI deployment, e.g. a
+// self-hosted mirror.
+func WithBaseURL(baseURL string) ClientOption {
+	return func(s *clientSettings) {
+		s.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(s *clientSettings) {
+		s.timeout = timeout
+	}
+}
+
+func WithTransport(transport http.RoundTripper) ClientOption {
+	return func(s *clientSettings) {
+		s.transport = transport
+	}
+}
+
+// WithCache makes the client use backend instead of creating its own
+// in-memory cache, the cache interval and options are ignored then.
+func WithCache(backend cache.Cache) ClientOption {
+	return func(s *clientSettings) {
+		s.cache = backend
+	}
+}
+
+func WithCacheInterval(interval time.Duration) ClientOption {
+	return func(s *clientSettings) {
+		s.cacheInterval = interval
+	}
+}
+
+func WithCacheOptions(opts ...cache.Option) ClientOption {
+	return func(s *clientSettings) {
+		s.cacheOptions = append(s.cacheOptions, opts...)
+	}
+}
+
+// WithOffline never touches the network, only cached data is served.
+func WithOffline(offline bool) ClientOption {
+	return func(s *clientSettings) {
+		s.offline = offline
+	}
+}
+
+// WithStaleWhileRevalidate serves expired cached data right away and
+// refreshes it in the background.
+func WithStaleWhileRevalidate(enabled bool) ClientOption {
+	return func(s *clientSettings) {
+		s.staleWhileRevalidate = enabled
+	}
+}
+
+// WithRetries retries failed requests up to maxRetries times, waiting delay
+// before the first retry and doubling it every time up to maxDelay. A
+// Retry-After from the server is followed, unless it asks to wait longer than
+// maxDelay, then the request fails right away.
+func WithRetries(maxRetries int, delay, maxDelay time.Duration) ClientOption {
+	return func(s *clientSettings) {
+		s.maxRetries = maxRetries
+		s.retryDelay = delay
+		s.maxRetryDelay = maxDelay
+	}
+}
+
+// WithRateLimit allows at most rate requests per second to PokeAPI, with
+// bursts of up to burst requests. Cache hits are never limited.
+func WithRateLimit(rate float64, burst int) ClientOption {
+	return func(s *clientSettings) {
+		s.rateLimit = rate
+		s.rateBurst = burst
+	}
+}
+
+func NewClient(opts ...ClientOption) Client {
+	settings := clientSettings{
+		baseURL:       defaultBaseURL,
+		timeout:       time.Minute,
+		cacheInterval: time.Hour,
+		maxRetries:    3,
+		retryDelay:    200 * time.Millisecond,
+		maxRetryDelay: 5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(&settings)
+	}
+	backend := settings.cache
+	if backend == nil {
+		// options passed in come last so they can change the retention.
+		cacheOptions := append([]cache.Option{cache.WithStaleRetention(staleRetention)}, settings.cacheOptions...)
+		backend = cache.NewCache(settings.cacheInterval, cacheOptions...)
+	}
+	var limiter *rateLimiter
+	if settings.rateLimit > 0 {
+		limiter = newRateLimiter(settings.rateLimit, settings.rateBurst)
+	}
+	return Client{
+		baseURL: settings.baseURL,
+		cache:   backend,
+		httpClient: http.Client{
+			Timeout:   settings.timeout,
+			Transport: settings.transport,
+		},
+		inflight:             &flightGroup{},
+		offline:              settings.offline,
+		staleWhileRevalidate: settings.staleWhileRevalidate,
+		maxRetries:           settings.maxRetries,
+		retryDelay:           settings.retryDelay,
+		maxRetryDelay:        settings.maxRetryDelay,
+		limiter:              limiter,
+		stats:                &clientStats{},
+	}
+}
+
+func (c *Client) Stats() ClientStats {
+	return ClientStats{
+		Requests:      c.stats.requests.Load(),
+		Retries:       c.stats.retries.Load(),
+		Throttled:     c.stats.throttled.Load(),
+		ThrottledTime: time.Duration(c.stats.throttledTime.Load()),
+	}
+}
+
+func (c *Client) Close() error {
+	return c.cache.Close()
+}
+
+func (c *Client) ListLocationAreas(pageURL *string) (LocationAreaResponse, error) {
+	return c.ListLocationAreasContext(context.Background(), pageURL)
+}
+
+func (c *Client) ListLocationAreasContext(ctx context.Context, pageURL *string) (LocationAreaResponse, error) {
+	fullURL := c.baseURL + "/location/"
+	if pageURL != nil {
+		fullURL = *pageURL
+	}
+	return fetch[LocationAreaResponse](ctx, c, fullURL, locationListTTL)
+}
+
+// nameIndexLimit is enough for PokeAPI to list every resource of a kind in
+// a single page.
+const nameIndexLimit = 100000
+
+func (c *Client) Names(kind string) ([]string, error) {
+	return c.NamesContext(context.Background(), kind)
+}
+
+// NamesContext returns the name of every resource of kind, e.g. "pokemon" or
+// "location". The index is cached like any other resource, so it is only
+// fetched once a day.
+func (c *Client) NamesContext(ctx context.Context, kind string) ([]string, error) {
+	fullURL := fmt.Sprintf("%s/%s/?limit=%d", c.baseURL, kind, nameIndexLimit)
+	// every list endpoint shares the shape of the location list.
+	response, err := fetch[LocationAreaResponse](ctx, c, fullURL, resourceTTL)
+	var staleErr *StaleError
+	if err != nil && !errors.As(err, &staleErr) {
+		return nil, err
+	}
+	names := make([]string, 0, len(response.Results))
+	for _, result := range response.Results {
+		names = append(names, result.Name)
+	}
+	return names, nil
+}
+
+func (c *Client) GetLocationArea(locationAreaName string) (LocationArea, error) {
+	return c.GetLocationAreaContext(context.Background(), locationAreaName)
+}
+
+func (c *Client) GetLocationAreaContext(ctx context.Context, locationAreaName string) (LocationArea, error) {
+	return fetch[LocationArea](ctx, c, c.baseURL+"/location/"+locationAreaName, resourceTTL)
+}
+
+func (c *Client) GetPokemon(name string) (Pokemon, error) {
+	return c.GetPokemonContext(context.Background(), name)
+}
+
+func (c *Client) GetPokemonContext(ctx context.Context, name string) (Pokemon, error) {
+	return fetch[Pokemon](ctx, c, c.baseURL+"/pokemon/"+name, resourceTTL)
+}
+
+// fetch is the single path every endpoint goes through: it serves fullURL
+// from the cache, fetching it on a miss, and decodes it into a T. The error
+// may be a *StaleError, in which case the decoded value is still usable.
+func fetch[T any](ctx context.Context, c *Client, fullURL string, ttl time.Duration) (T, error) {
+	var resource T
+	data, ok := c.cache.Get(fullURL)
+	var err error
+	var stale cache.CacheEntry
+	var hasStale bool
+	if !ok {
+		stale, hasStale = c.peek(fullURL)
+		data, err = c.fetchRaw(ctx, fullURL, ttl)
+		var staleErr *StaleError
+		if err != nil && !errors.As(err, &staleErr) {
+			return resource, err
+		}
+	}
+	jsonErr := json.Unmarshal(data, &resource)
+	if jsonErr == nil {
+		return resource, err
+	}
+	decodeErr := &DecodeError{URL: fullURL, Err: jsonErr}
+	// data came from the cache unless it was just downloaded, and a download
+	// is only cached when it is valid JSON.
+	cached := ok || err != nil || json.Valid(data)
+	if !ok && err == nil && hasStale {
+		// a broken fresh response, e.g. a captive portal page, falls back to
+		// the stale copy like an unreachable upstream does.
+		var fallback T
+		if json.Unmarshal(stale.Value(), &fallback) == nil {
+			if cached {
+				c.store(fullURL, stale.Value(), time.Until(stale.ExpiresAt()), stale.Validators())
+			}
+			return fallback, &StaleError{URL: fullURL, Err: decodeErr}
+		}
+	}
+	if cached {
+		// don't keep serving a response that can't be used.
+		c.cache.Delete(fullURL)
+	}
+	var zero T
+	return zero, decodeErr
+}
+
+// fetchRaw is called on a cache miss. Expired entries still in the cache are
+// served in offline mode, while the upstream is unreachable and, when
+// staleWhileRevalidate is set, while they are refreshed in the background.
+func (c *Client) fetchRaw(ctx context.Context, fullURL string, ttl time.Duration) ([]byte, error) {
+	stale, hasStale := c.peek(fullURL)
+	if c.offline {
+		if !hasStale {
+			return nil, fmt.Errorf("%w: %s", ErrOffline, fullURL)
+		}
+		return stale.Value(), &StaleError{URL: fullURL, Err: ErrOffline}
+	}
+	if c.staleWhileRevalidate && hasStale {
+		// the refresh outlives the request that triggered it.
+		go c.download(context.WithoutCancel(ctx), fullURL, ttl)
+		return stale.Value(), &StaleError{URL: fullURL, Err: ErrRevalidating}
+	}
+	data, err := c.download(ctx, fullURL, ttl)
+	if err != nil && hasStale && ctx.Err() == nil && unavailable(err) {
+		return stale.Value(), &StaleError{URL: fullURL, Err: err}
+	}
+	return data, err
+}
+
+// download fetches fullURL and fills the cache with it. Concurrent downloads
+// of the same URL share a single request, and transient failures are
+// retried with exponential backoff.
+func (c *Client) download(ctx context.Context, fullURL string, ttl time.Duration) ([]byte, error) {
+	return c.inflight.Do(ctx, fullURL, func(ctx context.Context) ([]byte, error) {
+		retries := 0
+		for {
+			data, err := c.attempt(ctx, fullURL, ttl)
+			var retryable *retryableError
+			if err == nil || !errors.As(err, &retryable) {
+				return data, withRetries(err, retries)
+			}
+			if retries >= c.maxRetries {
+				return nil, withRetries(retryable.err, retries)
+			}
+			if retryable.after > c.maxRetryDelay {
+				// retrying any earlier than asked would only be refused again.
+				var upstream *UpstreamError
+				if errors.As(retryable.err, &upstream) {
+					upstream.RetryAfter = retryable.after
+				}
+				return nil, withRetries(retryable.err, retries)
+			}
+			delay := retryable.after
+			if delay == 0 {
+				delay = c.backoff(retries)
+			}
+			retries++
+			c.stats.retries.Add(1)
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, withRetries(ctx.Err(), retries)
+			}
+		}
+	})
+}
+
+// attempt makes a single request for fullURL. An expired cache entry is
+// revalidated with its validators instead of downloaded again.
+func (c *Client) attempt(ctx context.Context, fullURL string, ttl time.Duration) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fullURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	stale, hasStale := c.peek(fullURL)
+	if hasStale {
+		validators := stale.Validators()
+		if validators.ETag != "" {
+			req.Header.Set("If-None-Match", validators.ETag)
+		}
+		if validators.LastModified != "" {
+			req.Header.Set("If-Modified-Since", validators.LastModified)
+		}
+	}
+	if c.limiter != nil {
+		waited, err := c.limiter.Wait(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if waited > 0 {
+			c.stats.throttled.Add(1)
+			c.stats.throttledTime.Add(int64(waited))
+		}
+	}
+	c.stats.requests.Add(1)
+	response, err := c.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		return nil, &retryableError{err: err}
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotModified && hasStale {
+		// only a Revalidator hands out stale entries.
+		c.cache.(cache.Revalidator).Refresh(fullURL, ttl)
+		return stale.Value(), nil
+	}
+	if response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500 {
+		return nil, &retryableError{
+			err:   &UpstreamError{StatusCode: response.StatusCode, URL: fullURL},
+			after: parseRetryAfter(response.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+	if response.StatusCode > 399 {
+		return nil, &UpstreamError{StatusCode: response.StatusCode, URL: fullURL}
+	}
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, &retryableError{err: err}
+	}
+	if !json.Valid(data) {
+		// e.g. a captive portal page or a truncated body, fetch decodes it
+		// into a DecodeError but it must not end up in the cache.
+		return data, nil
+	}
+	c.store(fullURL, data, ttl, cache.Validators{
+		ETag:         response.Header.Get("ETag"),
+		LastModified: response.Header.Get("Last-Modified"),
+	})
+	return data, nil
+}
+
+// peek returns the entry under key, even if it expired, as long as the
+// backend keeps expired entries around.
+func (c *Client) peek(key string) (cache.CacheEntry, bool) {
+	revalidator, ok := c.cache.(cache.Revalidator)
+	if !ok {
+		return cache.CacheEntry{}, false
+	}
+	return revalidator.Peek(key)
+}
+
+// store adds data to the cache with as much of ttl and validators as the
+// backend supports.
+func (c *Client) store(key string, data []byte, ttl time.Duration, validators cache.Validators) {
+	switch backend := c.cache.(type) {
+	case cache.Revalidator:
+		backend.AddWithValidators(key, data, ttl, validators)
+	case cache.TTLCache:
+		backend.AddWithTTL(key, data, ttl)
+	default:
+		c.cache.Add(key, data)
+	}
+}
+
+type retryableError struct {
+	err error
+	// after is how long the server asked us to wait, 0 if it didn't say.
+	after time.Duration
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+func withRetries(err error, retries int) error {
+	if err == nil || retries == 0 {
+		return err
+	}
+	var upstream *UpstreamError
+	if errors.As(err, &upstream) {
+		upstream.Retries = retries
+		return err
+	}
+	return fmt.Errorf("%w (after %d retries)", err, retries)
+}
+
+// backoff returns the delay before retry number n, doubling every time up
+// to maxRetryDelay with full jitter so clients don't retry in lockstep.
+func (c *Client) backoff(n int) time.Duration {
+	delay := c.retryDelay << n
+	if delay <= 0 || delay > c.maxRetryDelay {
+		delay = c.maxRetryDelay
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+// parseRetryAfter understands both forms of the Retry-After header, a
+// number of seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := date.Sub(now); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+type flightGroup struct {
+	mux   sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done    chan struct{}
+	data    []byte
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// Do runs fn once per key at a time, callers arriving while it is in flight
+// wait for and share its result. A caller whose ctx is done stops waiting
+// right away, fn itself is only cancelled once every caller gave up on it.
+func (g *flightGroup) Do(ctx context.Context, key string, fn func(context.Context) ([]byte, error)) ([]byte, error) {
+	g.mux.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	call, ok := g.calls[key]
+	if !ok {
+		flightCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		call = &flightCall{
+			done:   make(chan struct{}),
+			cancel: cancel,
+		}
+		g.calls[key] = call
+		go func() {
+			call.data, call.err = fn(flightCtx)
+			g.mux.Lock()
+			if g.calls[key] == call {
+				delete(g.calls, key)
+			}
+			g.mux.Unlock()
+			cancel()
+			close(call.done)
+		}()
+	}
+	call.waiters++
+	g.mux.Unlock()
+
+	select {
+	case <-call.done:
+		return call.data, call.err
+	case <-ctx.Done():
+		g.mux.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			call.cancel()
+			if g.calls[key] == call {
+				delete(g.calls, key)
+			}
+		}
+		g.mux.Unlock()
+		return nil, ctx.Err()
+	}
+}
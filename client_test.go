@@ -0,0 +1,688 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cache "github.com/cristhianjhlcom/pokedex/internal"
+)
+
+func TestFetchCoalescesConcurrentMisses(t *testing.T) {
+	var requests atomic.Int32
+	arrived := make(chan struct{}, 1)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		arrived <- struct{}{}
+		<-release
+		w.Write([]byte(`{"name":"pikachu"}`))
+	}))
+	defer server.Close()
+	client := NewClient(WithCacheInterval(time.Minute), WithCacheOptions(cache.WithStaleRetention(time.Hour)))
+	defer client.Close()
+	fullURL := server.URL + "/pokemon/pikachu"
+
+	const callers = 10
+	var wg sync.WaitGroup
+	results := make([]string, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data, err := client.fetchRaw(context.Background(), fullURL, time.Minute)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			results[i] = string(data)
+		}(i)
+	}
+	<-arrived
+	// hold the response until every caller joined the in-flight request.
+	for waiters(&client, fullURL) < callers {
+		runtime.Gosched()
+	}
+	close(release)
+	wg.Wait()
+
+	if n := requests.Load(); n != 1 {
+		t.Errorf("%d requests were made, expected 1", n)
+	}
+	for _, result := range results {
+		if result != `{"name":"pikachu"}` {
+			t.Errorf("%s is not the shared response", result)
+		}
+	}
+	if _, ok := client.cache.Get(fullURL); !ok {
+		t.Error("response should have been cached")
+	}
+}
+
+// waiters returns how many callers wait for the in-flight request of key.
+func waiters(client *Client, key string) int {
+	client.inflight.mux.Lock()
+	defer client.inflight.mux.Unlock()
+	call, ok := client.inflight.calls[key]
+	if !ok {
+		return 0
+	}
+	return call.waiters
+}
+
+func TestFetchRevalidatesExpiredEntry(t *testing.T) {
+	const etag = `"v1"`
+	const lastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+	var full, notModified atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag && r.Header.Get("If-Modified-Since") == lastModified {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full.Add(1)
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified)
+		w.Write([]byte(`{"name":"pikachu"}`))
+	}))
+	defer server.Close()
+	// the default cache keeps expired entries around to revalidate them.
+	client := NewClient(WithCacheInterval(time.Minute))
+	defer client.Close()
+	fullURL := server.URL + "/pokemon/pikachu"
+
+	ttl := 10 * time.Millisecond
+	if _, err := client.fetchRaw(context.Background(), fullURL, ttl); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(ttl * 2)
+	if _, ok := client.cache.Get(fullURL); ok {
+		t.Fatal("entry should have expired")
+	}
+	data, err := client.fetchRaw(context.Background(), fullURL, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"name":"pikachu"}` {
+		t.Errorf("%s is not the cached response", data)
+	}
+	if full.Load() != 1 || notModified.Load() != 1 {
+		t.Errorf("expected 1 full and 1 conditional request, got %d and %d", full.Load(), notModified.Load())
+	}
+	if _, ok := client.cache.Get(fullURL); !ok {
+		t.Error("entry should have been refreshed")
+	}
+}
+
+func TestFetchServesStaleWhenUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"pikachu"}`))
+	}))
+	client := NewClient(
+		WithCacheInterval(time.Minute),
+		WithCacheOptions(cache.WithStaleRetention(time.Hour)),
+		WithRetries(1, time.Millisecond, time.Millisecond),
+	)
+	defer client.Close()
+	fullURL := server.URL + "/pokemon/pikachu"
+	ttl := 10 * time.Millisecond
+	if _, err := client.fetchRaw(context.Background(), fullURL, ttl); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+	time.Sleep(ttl * 2)
+
+	data, err := client.fetchRaw(context.Background(), fullURL, ttl)
+	var staleErr *StaleError
+	if !errors.As(err, &staleErr) {
+		t.Fatalf("expected a stale error, got %v", err)
+	}
+	if string(data) != `{"name":"pikachu"}` {
+		t.Errorf("%s is not the cached response", data)
+	}
+	if _, err := client.fetchRaw(context.Background(), server.URL+"/pokemon/ditto", ttl); err == nil || errors.As(err, &staleErr) {
+		t.Errorf("uncached resources should fail, got %v", err)
+	}
+}
+
+func TestFetchOffline(t *testing.T) {
+	client := NewClient(
+		WithCacheInterval(time.Minute),
+		WithCacheOptions(cache.WithStaleRetention(time.Hour)),
+		WithOffline(true),
+	)
+	defer client.Close()
+	fullURL := "http://127.0.0.1:0/pokemon/pikachu"
+	if _, err := client.fetchRaw(context.Background(), fullURL, time.Minute); !errors.Is(err, ErrOffline) {
+		t.Errorf("expected ErrOffline, got %v", err)
+	}
+	client.store(fullURL, []byte(`{"name":"pikachu"}`), -time.Second, cache.Validators{})
+	data, err := client.fetchRaw(context.Background(), fullURL, time.Minute)
+	var staleErr *StaleError
+	if !errors.As(err, &staleErr) || !errors.Is(err, ErrOffline) {
+		t.Errorf("expected a stale offline error, got %v", err)
+	}
+	if string(data) != `{"name":"pikachu"}` {
+		t.Errorf("%s is not the cached response", data)
+	}
+}
+
+// mapCache is a backend written against nothing but the Cache interface.
+type mapCache struct {
+	entries map[string][]byte
+	stats   cache.Stats
+}
+
+func (m *mapCache) Get(key string) ([]byte, bool) {
+	value, ok := m.entries[key]
+	if ok {
+		m.stats.Hits++
+	} else {
+		m.stats.Misses++
+	}
+	return value, ok
+}
+
+func (m *mapCache) Add(key string, value []byte) {
+	m.entries[key] = value
+	m.stats.Adds++
+}
+
+func (m *mapCache) Delete(key string) bool {
+	_, ok := m.entries[key]
+	delete(m.entries, key)
+	return ok
+}
+
+func (m *mapCache) Stats() cache.Stats {
+	stats := m.stats
+	stats.Entries = len(m.entries)
+	return stats
+}
+
+func (m *mapCache) Close() error {
+	return nil
+}
+
+func TestClientUsesInjectedCache(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte(`{"name":"pikachu"}`))
+	}))
+	defer server.Close()
+	backend := &mapCache{entries: make(map[string][]byte)}
+	client := NewClient(WithBaseURL(server.URL), WithCache(backend))
+	defer client.Close()
+	for i := 0; i < 2; i++ {
+		pokemon, err := client.GetPokemon("pikachu")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pokemon.Name != "pikachu" {
+			t.Errorf("unexpected pokemon %q", pokemon.Name)
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("%d requests were made, expected 1", n)
+	}
+	if _, ok := backend.entries[server.URL+"/pokemon/pikachu"]; !ok {
+		t.Error("the response should have been added to the injected cache")
+	}
+}
+
+func TestFetchDecodesAndCaches(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path == "/pokemon/broken" {
+			w.Write([]byte(`{"name":`))
+			return
+		}
+		w.Write([]byte(`{"name":"pikachu","base_experience":112}`))
+	}))
+	defer server.Close()
+	client := NewClient(WithCacheInterval(time.Minute))
+	defer client.Close()
+
+	for i := 0; i < 2; i++ {
+		pokemon, err := fetch[Pokemon](context.Background(), &client, server.URL+"/pokemon/pikachu", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pokemon.Name != "pikachu" || pokemon.BaseExperience != 112 {
+			t.Errorf("unexpected pokemon %s (%d)", pokemon.Name, pokemon.BaseExperience)
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("%d requests were made, expected 1", n)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := fetch[Pokemon](context.Background(), &client, server.URL+"/pokemon/broken", time.Minute); err == nil {
+			t.Error("expected a decode error")
+		}
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("%d requests were made, expected the broken response not to be cached", n)
+	}
+	if _, ok := client.peek(server.URL + "/pokemon/broken"); ok {
+		t.Error("the broken response should not have been cached")
+	}
+}
+
+func TestFetchRecoversFromBrokenResponse(t *testing.T) {
+	cases := []struct {
+		name   string
+		broken string
+	}{
+		{
+			name:   "not json",
+			broken: `<html>sign in to the wifi</html>`,
+		},
+		{
+			name:   "wrong shape",
+			broken: `{"name":42}`,
+		},
+	}
+	for _, cs := range cases {
+		var requests atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if requests.Add(1) == 1 {
+				w.Write([]byte(cs.broken))
+				return
+			}
+			w.Write([]byte(`{"name":"pikachu"}`))
+		}))
+		client := NewClient(WithBaseURL(server.URL), WithCacheInterval(time.Minute))
+
+		var decodeErr *DecodeError
+		if _, err := client.GetPokemon("pikachu"); !errors.As(err, &decodeErr) {
+			t.Errorf("%s: expected a DecodeError, got %v", cs.name, err)
+		}
+		pokemon, err := client.GetPokemon("pikachu")
+		if err != nil {
+			t.Errorf("%s: %v", cs.name, err)
+		}
+		if pokemon.Name != "pikachu" {
+			t.Errorf("%s: unexpected pokemon %q", cs.name, pokemon.Name)
+		}
+		if n := requests.Load(); n != 2 {
+			t.Errorf("%s: %d requests were made, expected 2", cs.name, n)
+		}
+		client.Close()
+		server.Close()
+	}
+}
+
+func TestFetchFallsBackToStaleOnBrokenResponse(t *testing.T) {
+	cases := []struct {
+		name   string
+		broken string
+	}{
+		{
+			name:   "not json",
+			broken: `<html>portal</html>`,
+		},
+		{
+			name:   "wrong shape",
+			broken: `{"name":42}`,
+		},
+	}
+	for _, cs := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(cs.broken))
+		}))
+		client := NewClient(
+			WithBaseURL(server.URL),
+			WithCacheInterval(time.Minute),
+			WithCacheOptions(cache.WithStaleRetention(time.Hour)),
+		)
+		fullURL := server.URL + "/pokemon/pikachu"
+		client.store(fullURL, []byte(`{"name":"pikachu"}`), -time.Second, cache.Validators{})
+
+		pokemon, err := client.GetPokemon("pikachu")
+		var staleErr *StaleError
+		var decodeErr *DecodeError
+		if !errors.As(err, &staleErr) || !errors.As(err, &decodeErr) {
+			t.Errorf("%s: expected a StaleError wrapping a DecodeError, got %v", cs.name, err)
+		}
+		if pokemon.Name != "pikachu" {
+			t.Errorf("%s: unexpected pokemon %q", cs.name, pokemon.Name)
+		}
+		entry, ok := client.peek(fullURL)
+		if !ok || string(entry.Value()) != `{"name":"pikachu"}` {
+			t.Errorf("%s: the stale entry should still be cached", cs.name)
+		}
+		client.Close()
+		server.Close()
+	}
+}
+
+func TestNamesFetchedOnce(t *testing.T) {
+	var requests atomic.Int32
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		query = r.URL.RawQuery
+		w.Write([]byte(`{"count":2,"results":[{"name":"bulbasaur"},{"name":"ivysaur"}]}`))
+	}))
+	defer server.Close()
+	client := NewClient(WithBaseURL(server.URL), WithCacheInterval(time.Minute))
+	defer client.Close()
+
+	for i := 0; i < 2; i++ {
+		names, err := client.Names("pokemon")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(names, []string{"bulbasaur", "ivysaur"}) {
+			t.Errorf("unexpected names %v", names)
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("%d requests were made, expected 1", n)
+	}
+	if query != "limit=100000" {
+		t.Errorf("%s doesn't match limit=100000", query)
+	}
+}
+
+func TestFetchStaleWhileRevalidate(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte(`{"name":"raichu"}`))
+	}))
+	defer server.Close()
+	client := NewClient(
+		WithCacheInterval(time.Minute),
+		WithCacheOptions(cache.WithStaleRetention(time.Hour)),
+		WithStaleWhileRevalidate(true),
+	)
+	defer client.Close()
+	fullURL := server.URL + "/pokemon/pikachu"
+	client.store(fullURL, []byte(`{"name":"pikachu"}`), -time.Second, cache.Validators{})
+
+	pokemon, err := fetch[Pokemon](context.Background(), &client, fullURL, time.Minute)
+	var staleErr *StaleError
+	if !errors.As(err, &staleErr) || !errors.Is(err, ErrRevalidating) {
+		t.Errorf("expected the data to be flagged as stale, got %v", err)
+	}
+	if pokemon.Name != "pikachu" {
+		t.Errorf("%s is not the stale pokemon", pokemon.Name)
+	}
+	// the refresh happens in the background.
+	for {
+		if data, ok := client.cache.Get(fullURL); ok {
+			if string(data) != `{"name":"raichu"}` {
+				t.Errorf("%s is not the refreshed response", data)
+			}
+			break
+		}
+		runtime.Gosched()
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("%d requests were made, expected 1", n)
+	}
+}
+
+type countingTransport struct {
+	requests atomic.Int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests.Add(1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestClientOptions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/pokemon/pikachu" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"name":"pikachu"}`))
+	}))
+	defer server.Close()
+	transport := &countingTransport{}
+	client := NewClient(
+		WithBaseURL(server.URL+"/api/v2/"),
+		WithTransport(transport),
+		WithTimeout(time.Second),
+	)
+	defer client.Close()
+	pokemon, err := client.GetPokemon("pikachu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pokemon.Name != "pikachu" {
+		t.Errorf("%s doesn't match pikachu", pokemon.Name)
+	}
+	if n := transport.requests.Load(); n != 1 {
+		t.Errorf("%d requests went through the transport, expected 1", n)
+	}
+	if client.httpClient.Timeout != time.Second {
+		t.Errorf("timeout %v doesn't match 1s", client.httpClient.Timeout)
+	}
+}
+
+func TestFetchHonorsContext(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		select {
+		case <-release:
+			w.Write([]byte(`{"name":"pikachu"}`))
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+	client := NewClient(WithBaseURL(server.URL))
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.GetPokemonContext(ctx, "pikachu"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a deadline error, got %v", err)
+	}
+
+	// a waiter giving up must not cancel the request for the others.
+	short, cancelShort := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		_, err := client.GetPokemonContext(short, "ditto")
+		errs <- err
+	}()
+	result := make(chan error, 1)
+	go func() {
+		pokemon, err := client.GetPokemonContext(context.Background(), "ditto")
+		if err == nil && pokemon.Name != "pikachu" {
+			err = errors.New("unexpected pokemon " + pokemon.Name)
+		}
+		result <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancelShort()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a canceled error, got %v", err)
+	}
+	release <- struct{}{}
+	if err := <-result; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFetchRetriesTransientFailures(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch requests.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Write([]byte(`{"name":"pikachu"}`))
+		}
+	}))
+	defer server.Close()
+	client := NewClient(WithBaseURL(server.URL), WithRetries(3, time.Millisecond, 10*time.Millisecond))
+	defer client.Close()
+	pokemon, err := client.GetPokemon("pikachu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pokemon.Name != "pikachu" {
+		t.Errorf("%s doesn't match pikachu", pokemon.Name)
+	}
+	stats := client.Stats()
+	if stats.Requests != 3 || stats.Retries != 2 {
+		t.Errorf("expected 3 requests and 2 retries, got %+v", stats)
+	}
+}
+
+func TestFetchGivesUpOnLongRetryAfter(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	client := NewClient(WithBaseURL(server.URL), WithRetries(3, time.Millisecond, 10*time.Millisecond))
+	defer client.Close()
+	start := time.Now()
+	_, err := client.GetPokemon("pikachu")
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected a rate limited error, got %v", err)
+	}
+	var upstream *UpstreamError
+	if !errors.As(err, &upstream) || upstream.RetryAfter != time.Hour || upstream.Retries != 1 {
+		t.Errorf("expected the requested wait and 1 retry on the error, got %+v", upstream)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the client should give up instead of waiting, waited %v", elapsed)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("%d requests were made, expected 2", n)
+	}
+}
+
+func TestFetchGivesUpAfterMaxRetries(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path == "/pokemon/missingno" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	client := NewClient(WithBaseURL(server.URL), WithRetries(2, time.Millisecond, time.Millisecond))
+	defer client.Close()
+	_, err := client.GetPokemon("pikachu")
+	if err == nil || !strings.Contains(err.Error(), "after 2 retries") {
+		t.Errorf("expected the retry count in the error, got %v", err)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("%d requests were made, expected 3", n)
+	}
+	// client errors are not transient.
+	if _, err := client.GetPokemon("missingno"); err == nil {
+		t.Error("expected an error")
+	}
+	if n := requests.Load(); n != 4 {
+		t.Errorf("%d requests were made, expected 4", n)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		input    string
+		expected time.Duration
+	}{
+		{input: "", expected: 0},
+		{input: "3", expected: 3 * time.Second},
+		{input: "-1", expected: 0},
+		{input: "Mon, 01 Jan 2024 12:00:10 GMT", expected: 10 * time.Second},
+		{input: "Mon, 01 Jan 2024 11:00:00 GMT", expected: 0},
+		{input: "soon", expected: 0},
+	}
+	for _, cs := range cases {
+		actual := parseRetryAfter(cs.input, now)
+		if actual != cs.expected {
+			t.Errorf("%q: %v does not equal %v", cs.input, actual, cs.expected)
+		}
+	}
+}
+
+func TestRateLimitOnlyAppliesToMisses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"pikachu"}`))
+	}))
+	defer server.Close()
+	client := NewClient(WithBaseURL(server.URL), WithRateLimit(20, 1))
+	defer client.Close()
+	for i := 0; i < 3; i++ {
+		if _, err := client.GetPokemon("pikachu"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := client.Stats(); stats.Throttled != 0 {
+		t.Errorf("cache hits should not be throttled, got %+v", stats)
+	}
+	if _, err := client.GetPokemon("ditto"); err != nil {
+		t.Fatal(err)
+	}
+	if stats := client.Stats(); stats.Throttled != 1 || stats.ThrottledTime <= 0 {
+		t.Errorf("expected 1 throttled request, got %+v", stats)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pokemon/missingno":
+			http.NotFound(w, r)
+		case "/pokemon/busy":
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Write([]byte(`not json`))
+		}
+	}))
+	defer server.Close()
+	client := NewClient(WithBaseURL(server.URL), WithRetries(0, 0, 0))
+	defer client.Close()
+
+	_, err := client.GetPokemon("missingno")
+	var upstream *UpstreamError
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &upstream) {
+		t.Fatalf("expected a not found upstream error, got %v", err)
+	}
+	if upstream.StatusCode != http.StatusNotFound || upstream.URL != server.URL+"/pokemon/missingno" {
+		t.Errorf("unexpected upstream error %+v", upstream)
+	}
+	if _, err := client.GetPokemon("busy"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected ErrRateLimited, got %v", err)
+	}
+	_, err = client.GetPokemon("garbled")
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) || decodeErr.URL != server.URL+"/pokemon/garbled" {
+		t.Errorf("expected a decode error for the endpoint, got %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type CLICommand struct {
+	name        string
+	description string
+	// args are the positional arguments, checked before callback runs.
+	args  []commandArg
+	flags []commandFlag
+	// examples are shown by help {command}.
+	examples []string
+	callback func(context.Context, *Config, ...string) error
+}
+
+type argKind int
+
+const (
+	argText argKind = iota
+	// argNumber is a whole number of at least 1.
+	argNumber
+)
+
+type commandArg struct {
+	name        string
+	description string
+	kind        argKind
+	optional    bool
+	// variadic takes the remaining arguments, only the last one can be.
+	variadic bool
+	// choices limits the argument to these values, if set.
+	choices []string
+	// complete returns the values offered when completing the argument.
+	complete func(*Config) []string
+}
+
+type commandFlag struct {
+	name        string
+	description string
+	kind        argKind
+	// set applies the already validated value to config.
+	set func(*Config, string) error
+}
+
+// UsageError reports a command run with arguments it doesn't accept.
+type UsageError struct {
+	Usage   string
+	Message string
+}
+
+func (e *UsageError) Error() string {
+	return fmt.Sprintf("%s\nusage: %s", e.Message, e.Usage)
+}
+
+// usage returns the synopsis of the command, e.g. "map [--page {number}]".
+func (c CLICommand) usage() string {
+	parts := []string{c.name}
+	for _, f := range c.flags {
+		parts = append(parts, fmt.Sprintf("[--%s %s]", f.name, placeholder(f.name, f.kind)))
+	}
+	for _, arg := range c.args {
+		value := placeholder(arg.name, arg.kind)
+		if len(arg.choices) > 0 {
+			value = strings.Join(arg.choices, "|")
+		}
+		if arg.variadic {
+			value = strings.TrimSuffix(value, "}") + "...}"
+		}
+		if arg.optional {
+			value = "[" + strings.Trim(value, "{}") + "]"
+		}
+		parts = append(parts, value)
+	}
+	return strings.Join(parts, " ")
+}
+
+func placeholder(name string, kind argKind) string {
+	if kind == argNumber {
+		return "{number}"
+	}
+	return "{" + name + "}"
+}
+
+// parse checks args against the flags and arguments of the command and
+// returns the positional arguments. The flags are only applied to config
+// once all of args turned out to be valid.
+func (c CLICommand) parse(config *Config, args []string) ([]string, error) {
+	flags := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	// errors are reported as usage errors instead of being printed.
+	flags.SetOutput(io.Discard)
+	flags.Usage = func() {}
+	type flagValue struct {
+		flag  commandFlag
+		value string
+	}
+	values := []flagValue{}
+	for _, f := range c.flags {
+		flags.Func(f.name, f.description, func(value string) error {
+			if err := checkKind(f.kind, value); err != nil {
+				return err
+			}
+			values = append(values, flagValue{flag: f, value: value})
+			return nil
+		})
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		return nil, c.usageError(err.Error())
+	}
+	positional := []string{}
+	for _, arg := range flags.Args() {
+		// pokemon and location names are lower case.
+		positional = append(positional, strings.ToLower(arg))
+	}
+	variadic := len(c.args) > 0 && c.args[len(c.args)-1].variadic
+	if len(positional) > len(c.args) && !variadic {
+		return nil, c.usageError("too many arguments")
+	}
+	for i, arg := range c.args {
+		if i >= len(positional) {
+			if !arg.optional {
+				return nil, c.usageError("missing " + arg.name)
+			}
+			continue
+		}
+		value := positional[i]
+		if err := checkKind(arg.kind, value); err != nil {
+			return nil, c.usageError(fmt.Sprintf("%s: %v", arg.name, err))
+		}
+		if len(arg.choices) > 0 && !slices.Contains(arg.choices, value) {
+			return nil, c.usageError(fmt.Sprintf("unknown %s %q", arg.name, value))
+		}
+	}
+	for _, v := range values {
+		if err := v.flag.set(config, v.value); err != nil {
+			return nil, c.usageError(err.Error())
+		}
+	}
+	return positional, nil
+}
+
+func (c CLICommand) usageError(message string) error {
+	return &UsageError{Usage: c.usage(), Message: message}
+}
+
+func checkKind(kind argKind, value string) error {
+	if kind != argNumber {
+		return nil
+	}
+	if n, err := strconv.Atoi(value); err != nil || n < 1 {
+		return fmt.Errorf("%q is not a number of at least 1", value)
+	}
+	return nil
+}
+
+// printHelp writes the detailed help of the command shown by help {command}.
+func (c CLICommand) printHelp(out io.Writer) {
+	fmt.Fprintf(out, "Usage: %s\n", c.usage())
+	fmt.Fprintln(out, c.description)
+	if len(c.args) > 0 {
+		fmt.Fprintln(out, "Arguments:")
+		for _, arg := range c.args {
+			fmt.Fprintf(out, " - %s: %s\n", arg.name, arg.description)
+		}
+	}
+	if len(c.flags) > 0 {
+		fmt.Fprintln(out, "Flags:")
+		for _, f := range c.flags {
+			fmt.Fprintf(out, " - --%s %s: %s\n", f.name, placeholder(f.name, f.kind), f.description)
+		}
+	}
+	if len(c.examples) > 0 {
+		fmt.Fprintln(out, "Examples:")
+		for _, example := range c.examples {
+			fmt.Fprintf(out, " - %s\n", example)
+		}
+	}
+}
+
+// commandNames returns the names of the commands in alphabetical order.
+func commandNames(commands map[string]CLICommand) []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCommandUsage(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected string
+	}{
+		{
+			input:    "help",
+			expected: "help [command]",
+		},
+		{
+			input:    "map",
+			expected: "map [--page {number}]",
+		},
+		{
+			input:    "explore",
+			expected: "explore {location_area}",
+		},
+		{
+			input:    "cache",
+			expected: "cache [keys|inspect|clear] [key]",
+		},
+	}
+	for _, cs := range cases {
+		actual := getCommands()[cs.input].usage()
+		if actual != cs.expected {
+			t.Errorf("%v does not equal %v", actual, cs.expected)
+		}
+	}
+}
+
+func TestCommandParse(t *testing.T) {
+	cases := []struct {
+		command  string
+		args     []string
+		expected []string
+		err      string
+	}{
+		{
+			command:  "catch",
+			args:     []string{"Pikachu"},
+			expected: []string{"pikachu"},
+		},
+		{
+			command: "catch",
+			args:    []string{},
+			err:     "missing pokemon_name",
+		},
+		{
+			command: "catch",
+			args:    []string{"pikachu", "ditto"},
+			err:     "too many arguments",
+		},
+		{
+			command:  "cache",
+			args:     []string{},
+			expected: []string{},
+		},
+		{
+			command: "cache",
+			args:    []string{"purge"},
+			err:     `unknown subcommand "purge"`,
+		},
+		{
+			command: "map",
+			args:    []string{"--page", "0"},
+			err:     `invalid value "0" for flag -page: "0" is not a number of at least 1`,
+		},
+	}
+	for _, cs := range cases {
+		config := &Config{}
+		actual, err := getCommands()[cs.command].parse(config, cs.args)
+		if cs.err != "" {
+			var usageErr *UsageError
+			if !errors.As(err, &usageErr) || usageErr.Message != cs.err {
+				t.Errorf("%s %v: expected usage error %q, got %v", cs.command, cs.args, cs.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %v: %v", cs.command, cs.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, cs.expected) {
+			t.Errorf("%v does not equal %v", actual, cs.expected)
+		}
+	}
+}
+
+func TestCommandParseAppliesFlagsOnlyWhenValid(t *testing.T) {
+	config := &Config{pokeAPIClient: NewClient(WithBaseURL("http://pokeapi.test"))}
+	defer config.pokeAPIClient.Close()
+	command := getCommands()["map"]
+	if _, err := command.parse(config, []string{"--page", "3", "extra"}); err == nil {
+		t.Fatal("expected a usage error")
+	}
+	if config.nextLocationAreaURL != nil {
+		t.Errorf("an invalid command moved the page to %s", *config.nextLocationAreaURL)
+	}
+	if _, err := command.parse(config, []string{"--page", "3"}); err != nil {
+		t.Fatal(err)
+	}
+	expected := "http://pokeapi.test/location/?offset=40&limit=20"
+	if config.nextLocationAreaURL == nil || *config.nextLocationAreaURL != expected {
+		t.Errorf("the page should have moved to %s", expected)
+	}
+}
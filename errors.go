@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrRateLimited = errors.New("rate limited")
+	ErrOffline     = errors.New("not available offline")
+	// ErrRevalidating flags stale data served while a fresh copy is fetched
+	// in the background.
+	ErrRevalidating = errors.New("refreshing in the background")
+)
+
+// UpstreamError is returned when PokeAPI answers with an error status. It
+// matches ErrNotFound and ErrRateLimited with errors.Is where it applies.
+type UpstreamError struct {
+	StatusCode int
+	URL        string
+	Retries    int
+	// RetryAfter is how long the server asked to wait before trying again,
+	// if it asked for longer than the client is willing to wait.
+	RetryAfter time.Duration
+}
+
+func (e *UpstreamError) Error() string {
+	msg := fmt.Sprintf("bad status code %d from %s", e.StatusCode, e.URL)
+	if e.Retries > 0 {
+		msg += fmt.Sprintf(" (after %d retries)", e.Retries)
+	}
+	return msg
+}
+
+func (e *UpstreamError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// DecodeError is returned when a response from URL isn't the JSON we
+// expected.
+type DecodeError struct {
+	URL string
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decoding %s: %v", e.URL, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// StaleError is returned together with expired cached data when a fresh
+// copy couldn't be fetched.
+type StaleError struct {
+	URL string
+	Err error
+}
+
+func (e *StaleError) Error() string {
+	return fmt.Sprintf("serving stale data for %s: %v", e.URL, e.Err)
+}
+
+func (e *StaleError) Unwrap() error {
+	return e.Err
+}
+
+// SuggestionError adds the names that were probably meant to an error
+// about a mistyped one.
+type SuggestionError struct {
+	Err         error
+	Suggestions []string
+}
+
+func (e *SuggestionError) Error() string {
+	return fmt.Sprintf("%v, did you mean %s?", e.Err, strings.Join(e.Suggestions, " or "))
+}
+
+func (e *SuggestionError) Unwrap() error {
+	return e.Err
+}
+
+// unavailable reports whether err means PokeAPI couldn't be reached or is
+// having an outage, as opposed to rejecting the request.
+func unavailable(err error) bool {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return true
+	}
+	var upstream *UpstreamError
+	return errors.As(err, &upstream) && upstream.StatusCode >= 500
+}
@@ -1,3 +1,7 @@
 module github.com/cristhianjhlcom/pokedex
 
 go 1.22.3
+
+require golang.org/x/term v0.29.0
+
+require golang.org/x/sys v0.30.0 // indirect
@@ -1,59 +1,468 @@
 package cache
 
 import (
+	"container/list"
+	"sort"
 	"sync"
 	"time"
 )
 
-type Cache struct {
-	cache map[string]CacheEntry
-	mux   *sync.Mutex
+// Cache is what Client needs from a cache backend. Backends can also
+// implement TTLCache, Revalidator and Browser to support per-entry TTLs,
+// revalidation and stale data, and listing their entries.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Add(key string, value []byte)
+	Delete(key string) bool
+	Stats() Stats
+	Close() error
+}
+
+// TTLCache stores entries that expire after their own ttl.
+type TTLCache interface {
+	AddWithTTL(key string, value []byte, ttl time.Duration)
+}
+
+// Revalidator keeps expired entries along with their HTTP validators, so
+// they can be revalidated or served when no fresh copy can be fetched.
+type Revalidator interface {
+	Peek(key string) (CacheEntry, bool)
+	AddWithValidators(key string, value []byte, ttl time.Duration, validators Validators)
+	Refresh(key string, ttl time.Duration) bool
+}
+
+// Browser lists and clears the cached entries.
+type Browser interface {
+	Keys() []string
+	Clear()
+}
+
+var (
+	_ Cache       = (*MemoryCache)(nil)
+	_ TTLCache    = (*MemoryCache)(nil)
+	_ Revalidator = (*MemoryCache)(nil)
+	_ Browser     = (*MemoryCache)(nil)
+)
+
+// MemoryCache keeps entries in a map, optionally backed by a directory on
+// disk.
+type MemoryCache struct {
+	cache      map[string]CacheEntry
+	mux        *sync.Mutex
+	interval   time.Duration
+	dir        string
+	maxBytes   int
+	maxEntries int
+	// staleRetention keeps expired entries around so they can still be
+	// revalidated before the reaper drops them.
+	staleRetention time.Duration
+	compress       bool
+	// size counts the stored bytes, rawSize what they decompress to.
+	size    int
+	rawSize int
+	// recency holds the keys ordered from most to least recently used.
+	recency   *list.List
+	done      chan struct{}
+	closeOnce sync.Once
+	stats     Stats
 }
 
 type CacheEntry struct {
-	value     []byte
-	createdAt time.Time
+	value      []byte
+	compressed bool
+	rawSize    int
+	createdAt  time.Time
+	expiresAt  time.Time
+	validators Validators
+	element    *list.Element
+}
+
+// NewEntry returns an entry for backends to hand out from Peek.
+func NewEntry(value []byte, createdAt, expiresAt time.Time, validators Validators) CacheEntry {
+	return CacheEntry{
+		value:      value,
+		rawSize:    len(value),
+		createdAt:  createdAt,
+		expiresAt:  expiresAt,
+		validators: validators,
+	}
+}
+
+// Validators are the HTTP validators a cached response was served with.
+type Validators struct {
+	ETag         string
+	LastModified string
+}
+
+type Stats struct {
+	Hits      int
+	Misses    int
+	Adds      int
+	Refreshes int
+	Reaped    int
+	Evictions int
+	Entries   int
+	Bytes     int
+	RawBytes  int
+}
+
+// CompressionRatio is the uncompressed size of the cached values divided by
+// the space they take up.
+func (s Stats) CompressionRatio() float64 {
+	if s.Bytes == 0 {
+		return 1
+	}
+	return float64(s.RawBytes) / float64(s.Bytes)
+}
+
+type Option func(*MemoryCache)
+
+// WithDir persists entries under dir so they survive restarts. Entries are
+// loaded on creation, written through on Add and removed when reaped.
+func WithDir(dir string) Option {
+	return func(c *MemoryCache) {
+		c.dir = dir
+	}
+}
+
+// WithMaxBytes bounds the total size of the cached values, evicting the
+// least recently used entries once it is exceeded.
+func WithMaxBytes(n int) Option {
+	return func(c *MemoryCache) {
+		c.maxBytes = n
+	}
+}
+
+// WithMaxEntries bounds the number of cached entries, evicting the least
+// recently used entries once it is exceeded.
+func WithMaxEntries(n int) Option {
+	return func(c *MemoryCache) {
+		c.maxEntries = n
+	}
+}
+
+// WithCompression gzips values on Add and transparently decompresses them on
+// Get, trading some CPU for memory and disk space.
+func WithCompression() Option {
+	return func(c *MemoryCache) {
+		c.compress = true
+	}
+}
+
+// WithStaleRetention keeps expired entries for d before reaping them. Get
+// still treats them as misses, but Peek returns them and Refresh can bring
+// them back.
+func WithStaleRetention(d time.Duration) Option {
+	return func(c *MemoryCache) {
+		c.staleRetention = d
+	}
 }
 
-func NewCache(interval time.Duration) Cache {
-	c := Cache{
-		cache: make(map[string]CacheEntry),
-		mux:   &sync.Mutex{},
+func NewCache(interval time.Duration, opts ...Option) *MemoryCache {
+	c := &MemoryCache{
+		cache:    make(map[string]CacheEntry),
+		mux:      &sync.Mutex{},
+		interval: interval,
+		recency:  list.New(),
+		done:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.dir != "" {
+		c.load()
 	}
 	go c.reapLoop(interval)
 	return c
 }
 
-func (c *Cache) Add(key string, value []byte) {
+// Add stores value under key, expiring after the interval the cache was
+// created with.
+func (c *MemoryCache) Add(key string, value []byte) {
+	c.AddWithTTL(key, value, c.interval)
+}
+
+func (c *MemoryCache) AddWithTTL(key string, value []byte, ttl time.Duration) {
+	c.AddWithValidators(key, value, ttl, Validators{})
+}
+
+func (c *MemoryCache) AddWithValidators(key string, value []byte, ttl time.Duration, validators Validators) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.remove(key)
+	now := time.Now().UTC()
+	entry := CacheEntry{
+		value:      value,
+		rawSize:    len(value),
+		createdAt:  now,
+		expiresAt:  now.Add(ttl),
+		validators: validators,
+	}
+	if c.compress {
+		// values that can't be compressed are just stored as they are.
+		if compressed, err := compress(value); err == nil {
+			entry.value = compressed
+			entry.compressed = true
+		}
+	}
+	c.insert(key, entry)
+	c.stats.Adds++
+	if c.dir != "" {
+		// the disk is only a backing store, a failed write just means the
+		// entry won't survive a restart.
+		_ = writeEntry(c.dir, key, entry)
+	}
+	c.evict()
+}
+
+func (c *MemoryCache) Get(key string) ([]byte, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	entry, ok := c.cache[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	// the reaper only runs once per interval, don't hand out entries that
+	// are already due.
+	if entry.expired(time.Now().UTC()) {
+		c.stats.Misses++
+		return nil, false
+	}
+	entry, err := entry.decompressed()
+	if err != nil {
+		// corrupted, don't let it come back on the next start either.
+		c.remove(key)
+		if c.dir != "" {
+			_ = removeEntry(c.dir, key)
+		}
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	c.recency.MoveToFront(entry.element)
+	return entry.value, true
+}
+
+// Refresh marks the entry stored under key as fresh for another ttl, e.g.
+// after the origin confirmed it didn't change.
+func (c *MemoryCache) Refresh(key string, ttl time.Duration) bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	entry, ok := c.cache[key]
+	if !ok {
+		return false
+	}
+	entry.expiresAt = time.Now().UTC().Add(ttl)
+	c.cache[key] = entry
+	c.recency.MoveToFront(entry.element)
+	c.stats.Refreshes++
+	if c.dir != "" {
+		_ = writeEntry(c.dir, key, entry)
+	}
+	return true
+}
+
+// Peek returns the entry stored under key without touching the statistics
+// or its recency.
+func (c *MemoryCache) Peek(key string) (CacheEntry, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	entry, ok := c.cache[key]
+	if !ok {
+		return CacheEntry{}, false
+	}
+	entry, err := entry.decompressed()
+	if err != nil {
+		return CacheEntry{}, false
+	}
+	return entry, true
+}
+
+func (c *MemoryCache) Delete(key string) bool {
 	c.mux.Lock()
 	defer c.mux.Unlock()
-	c.cache[key] = CacheEntry{
-		value:     value,
-		createdAt: time.Now().UTC(),
+	_, ok := c.cache[key]
+	if !ok {
+		return false
+	}
+	c.remove(key)
+	if c.dir != "" {
+		_ = removeEntry(c.dir, key)
 	}
+	return true
 }
 
-func (c *Cache) Get(key string) ([]byte, bool) {
+func (c *MemoryCache) Clear() {
 	c.mux.Lock()
 	defer c.mux.Unlock()
+	for k := range c.cache {
+		c.remove(k)
+		if c.dir != "" {
+			_ = removeEntry(c.dir, k)
+		}
+	}
+}
+
+// Keys returns the cached keys, most recently used first.
+func (c *MemoryCache) Keys() []string {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	keys := make([]string, 0, c.recency.Len())
+	for e := c.recency.Front(); e != nil; e = e.Next() {
+		keys = append(keys, e.Value.(string))
+	}
+	return keys
+}
+
+func (c *MemoryCache) Stats() Stats {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	stats := c.stats
+	stats.Entries = len(c.cache)
+	stats.Bytes = c.size
+	stats.RawBytes = c.rawSize
+	return stats
+}
+
+// Close stops the reaper goroutine. It is safe to call more than once.
+func (c *MemoryCache) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	return nil
+}
+
+func (c *MemoryCache) insert(key string, entry CacheEntry) {
+	entry.element = c.recency.PushFront(key)
+	c.cache[key] = entry
+	c.size += len(entry.value)
+	c.rawSize += entry.rawSize
+}
+
+func (c *MemoryCache) remove(key string) {
 	entry, ok := c.cache[key]
-	return entry.value, ok
+	if !ok {
+		return
+	}
+	c.recency.Remove(entry.element)
+	delete(c.cache, key)
+	c.size -= len(entry.value)
+	c.rawSize -= entry.rawSize
+}
+
+func (c *MemoryCache) evict() {
+	for c.overBudget() {
+		oldest := c.recency.Back()
+		if oldest == nil {
+			return
+		}
+		key := oldest.Value.(string)
+		c.remove(key)
+		c.stats.Evictions++
+		if c.dir != "" {
+			_ = removeEntry(c.dir, key)
+		}
+	}
 }
 
-func (c *Cache) reapLoop(interval time.Duration) {
+func (c *MemoryCache) overBudget() bool {
+	if c.maxEntries > 0 && len(c.cache) > c.maxEntries {
+		return true
+	}
+	return c.maxBytes > 0 && c.size > c.maxBytes
+}
+
+func (c *MemoryCache) reapLoop(interval time.Duration) {
 	ticker := time.NewTicker(interval)
-	for range ticker.C {
-		c.reap(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.reap()
+		case <-c.done:
+			return
+		}
 	}
 }
 
-func (c *Cache) reap(interval time.Duration) {
+func (c *MemoryCache) reap() {
 	c.mux.Lock()
 	defer c.mux.Unlock()
-	timeAgo := time.Now().UTC().Add(-interval)
+	now := time.Now().UTC()
 	for k, v := range c.cache {
-		if v.createdAt.Before(timeAgo) {
-			delete(c.cache, k)
+		if v.expired(now.Add(-c.staleRetention)) {
+			c.remove(k)
+			c.stats.Reaped++
+			if c.dir != "" {
+				_ = removeEntry(c.dir, k)
+			}
 		}
 	}
 }
+
+func (c *MemoryCache) load() {
+	entries, err := readEntries(c.dir)
+	if err != nil {
+		return
+	}
+	now := time.Now().UTC()
+	keys := make([]string, 0, len(entries))
+	for k, v := range entries {
+		if v.expiresAt.IsZero() {
+			// written before entries carried their own expiry.
+			v.expiresAt = v.createdAt.Add(c.interval)
+			entries[k] = v
+		}
+		if v.expired(now.Add(-c.staleRetention)) {
+			_ = removeEntry(c.dir, k)
+			continue
+		}
+		keys = append(keys, k)
+	}
+	// oldest first so the newest entries end up as the most recently used.
+	sort.Slice(keys, func(i, j int) bool {
+		return entries[keys[i]].createdAt.Before(entries[keys[j]].createdAt)
+	})
+	for _, k := range keys {
+		c.insert(k, entries[k])
+	}
+	c.evict()
+}
+
+func (e CacheEntry) Value() []byte {
+	return e.value
+}
+
+func (e CacheEntry) CreatedAt() time.Time {
+	return e.createdAt
+}
+
+func (e CacheEntry) ExpiresAt() time.Time {
+	return e.expiresAt
+}
+
+func (e CacheEntry) Validators() Validators {
+	return e.validators
+}
+
+func (e CacheEntry) Expired() bool {
+	return e.expired(time.Now().UTC())
+}
+
+func (e CacheEntry) decompressed() (CacheEntry, error) {
+	if !e.compressed {
+		return e, nil
+	}
+	value, err := decompress(e.value)
+	if err != nil {
+		return CacheEntry{}, err
+	}
+	e.value = value
+	e.compressed = false
+	return e, nil
+}
+
+func (e CacheEntry) expired(now time.Time) bool {
+	return now.After(e.expiresAt)
+}
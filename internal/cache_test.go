@@ -1,12 +1,14 @@
 package cache
 
 import (
+	"strings"
 	"testing"
 	"time"
 )
 
 func TestCreateCache(t *testing.T) {
 	cache := NewCache(time.Millisecond)
+	defer cache.Close()
 	if cache.cache == nil {
 		t.Error("cache is nil")
 	}
@@ -14,6 +16,7 @@ func TestCreateCache(t *testing.T) {
 
 func TestAddGetCache(t *testing.T) {
 	cache := NewCache(time.Millisecond)
+	defer cache.Close()
 	cases := []struct {
 		inputKey string
 		inputVal []byte
@@ -49,6 +52,7 @@ func TestAddGetCache(t *testing.T) {
 func TestReap(t *testing.T) {
 	interval := time.Millisecond * 10
 	cache := NewCache(interval)
+	defer cache.Close()
 	keyOne := "key1"
 	cache.Add(keyOne, []byte("val1"))
 	time.Sleep(interval + time.Millisecond)
@@ -61,11 +65,212 @@ func TestReap(t *testing.T) {
 func TestReapFail(t *testing.T) {
 	interval := time.Millisecond * 10
 	cache := NewCache(interval)
+	defer cache.Close()
 	keyOne := "key1"
 	cache.Add(keyOne, []byte("val1"))
 	time.Sleep(interval / 2)
 	_, ok := cache.Get(keyOne)
-	if ok {
+	if !ok {
 		t.Errorf("%s should not have been reaped", keyOne)
 	}
 }
+
+func TestEvictMaxEntries(t *testing.T) {
+	cache := NewCache(time.Minute, WithMaxEntries(2))
+	defer cache.Close()
+	cache.Add("key1", []byte("val1"))
+	cache.Add("key2", []byte("val2"))
+	// touch key1 so key2 becomes the least recently used.
+	cache.Get("key1")
+	cache.Add("key3", []byte("val3"))
+	if _, ok := cache.Get("key2"); ok {
+		t.Error("key2 should have been evicted")
+	}
+	for _, key := range []string{"key1", "key3"} {
+		if _, ok := cache.Get(key); !ok {
+			t.Errorf("%s should not have been evicted", key)
+		}
+	}
+}
+
+func TestEvictMaxBytes(t *testing.T) {
+	cache := NewCache(time.Minute, WithMaxBytes(8))
+	defer cache.Close()
+	cache.Add("key1", []byte("val1"))
+	cache.Add("key2", []byte("val2"))
+	cache.Add("key3", []byte("val3"))
+	if _, ok := cache.Get("key1"); ok {
+		t.Error("key1 should have been evicted")
+	}
+	if cache.size != 8 {
+		t.Errorf("size %d doesn't match 8", cache.size)
+	}
+}
+
+func TestEvictReplaceKeepsSize(t *testing.T) {
+	cache := NewCache(time.Minute, WithMaxEntries(1))
+	defer cache.Close()
+	cache.Add("key1", []byte("val1"))
+	cache.Add("key1", []byte("value1"))
+	actual, ok := cache.Get("key1")
+	if !ok {
+		t.Fatal("key1 not found")
+	}
+	if string(actual) != "value1" {
+		t.Errorf("%s doesn't match value1", string(actual))
+	}
+	if cache.size != len("value1") {
+		t.Errorf("size %d doesn't match %d", cache.size, len("value1"))
+	}
+}
+
+func TestClose(t *testing.T) {
+	interval := time.Millisecond * 10
+	cache := NewCache(interval)
+	cache.Add("key1", []byte("val1"))
+	if err := cache.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Close(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(interval * 3)
+	if _, ok := cache.cache["key1"]; !ok {
+		t.Error("key1 should not have been reaped after Close")
+	}
+}
+
+func TestStats(t *testing.T) {
+	cache := NewCache(time.Minute, WithMaxEntries(1))
+	defer cache.Close()
+	cache.Add("key1", []byte("val1"))
+	cache.Get("key1")
+	cache.Get("key2")
+	cache.Add("key2", []byte("value2"))
+	expected := Stats{
+		Hits:      1,
+		Misses:    1,
+		Adds:      2,
+		Evictions: 1,
+		Entries:   1,
+		Bytes:     len("value2"),
+		RawBytes:  len("value2"),
+	}
+	if actual := cache.Stats(); actual != expected {
+		t.Errorf("%+v doesn't match %+v", actual, expected)
+	}
+}
+
+func TestDeleteClear(t *testing.T) {
+	cache := NewCache(time.Minute)
+	defer cache.Close()
+	cache.Add("key1", []byte("val1"))
+	cache.Add("key2", []byte("val2"))
+	if !cache.Delete("key1") {
+		t.Error("key1 should have been deleted")
+	}
+	if cache.Delete("key1") {
+		t.Error("key1 should already be gone")
+	}
+	keys := cache.Keys()
+	if len(keys) != 1 || keys[0] != "key2" {
+		t.Errorf("%v doesn't match [key2]", keys)
+	}
+	cache.Clear()
+	if stats := cache.Stats(); stats.Entries != 0 || stats.Bytes != 0 {
+		t.Errorf("cache should be empty, got %+v", stats)
+	}
+}
+
+func TestAddWithTTL(t *testing.T) {
+	interval := time.Millisecond * 10
+	cache := NewCache(interval)
+	defer cache.Close()
+	cache.AddWithTTL("short", []byte("val1"), interval)
+	cache.AddWithTTL("long", []byte("val2"), time.Minute)
+	time.Sleep(interval * 3)
+	if _, ok := cache.Get("short"); ok {
+		t.Error("short should have expired")
+	}
+	if _, ok := cache.Get("long"); !ok {
+		t.Error("long should not have expired")
+	}
+	if _, ok := cache.cache["short"]; ok {
+		t.Error("short should have been reaped")
+	}
+}
+
+func TestStaleRetentionRefresh(t *testing.T) {
+	interval := time.Millisecond * 10
+	cache := NewCache(interval, WithStaleRetention(time.Minute))
+	defer cache.Close()
+	validators := Validators{ETag: `"v1"`}
+	cache.AddWithValidators("key1", []byte("val1"), interval, validators)
+	time.Sleep(interval * 3)
+	if _, ok := cache.Get("key1"); ok {
+		t.Error("key1 should have expired")
+	}
+	entry, ok := cache.Peek("key1")
+	if !ok {
+		t.Fatal("key1 should have been retained")
+	}
+	if !entry.Expired() {
+		t.Error("key1 should be flagged as expired")
+	}
+	if entry.Validators() != validators {
+		t.Errorf("%+v doesn't match %+v", entry.Validators(), validators)
+	}
+	if !cache.Refresh("key1", time.Minute) {
+		t.Fatal("key1 should have been refreshed")
+	}
+	actual, ok := cache.Get("key1")
+	if !ok {
+		t.Fatal("key1 should be fresh again")
+	}
+	if string(actual) != "val1" {
+		t.Errorf("%s doesn't match val1", string(actual))
+	}
+}
+
+func TestCompression(t *testing.T) {
+	cache := NewCache(time.Minute, WithCompression())
+	defer cache.Close()
+	value := []byte(strings.Repeat(`{"name":"pikachu"}`, 100))
+	cache.Add("key1", value)
+	actual, ok := cache.Get("key1")
+	if !ok {
+		t.Fatal("key1 not found")
+	}
+	if string(actual) != string(value) {
+		t.Error("decompressed value doesn't match")
+	}
+	entry, ok := cache.Peek("key1")
+	if !ok || string(entry.Value()) != string(value) {
+		t.Error("peeked value doesn't match")
+	}
+	stats := cache.Stats()
+	if stats.RawBytes != len(value) {
+		t.Errorf("raw bytes %d doesn't match %d", stats.RawBytes, len(value))
+	}
+	if stats.Bytes >= stats.RawBytes || stats.CompressionRatio() <= 1 {
+		t.Errorf("value should have been compressed, got %+v", stats)
+	}
+}
+
+func TestNewEntry(t *testing.T) {
+	created := time.Now().UTC()
+	validators := Validators{ETag: `"abc"`}
+	entry := NewEntry([]byte("val1"), created, created.Add(time.Minute), validators)
+	if string(entry.Value()) != "val1" {
+		t.Errorf("%s doesn't match val1", entry.Value())
+	}
+	if !entry.CreatedAt().Equal(created) || !entry.ExpiresAt().Equal(created.Add(time.Minute)) {
+		t.Errorf("unexpected times %v, %v", entry.CreatedAt(), entry.ExpiresAt())
+	}
+	if entry.Validators() != validators {
+		t.Errorf("%+v doesn't match %+v", entry.Validators(), validators)
+	}
+	if entry.Expired() {
+		t.Error("entry shouldn't have expired yet")
+	}
+}
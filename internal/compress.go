@@ -0,0 +1,28 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+func compress(value []byte) ([]byte, error) {
+	buf := bytes.Buffer{}
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(value); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decompress(value []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(value))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
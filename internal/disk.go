@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const entryExt = ".json"
+
+type diskEntry struct {
+	Key          string    `json:"key"`
+	Value        []byte    `json:"value"`
+	Compressed   bool      `json:"compressed,omitempty"`
+	RawSize      int       `json:"raw_size"`
+	CreatedAt    time.Time `json:"created_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+}
+
+func entryPath(dir, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+entryExt)
+}
+
+func writeEntry(dir, key string, entry CacheEntry) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(diskEntry{
+		Key:          key,
+		Value:        entry.value,
+		Compressed:   entry.compressed,
+		RawSize:      entry.rawSize,
+		CreatedAt:    entry.createdAt,
+		ExpiresAt:    entry.expiresAt,
+		ETag:         entry.validators.ETag,
+		LastModified: entry.validators.LastModified,
+	})
+	if err != nil {
+		return err
+	}
+	// write to a temporary file first so a crash never leaves a half
+	// written entry behind.
+	tmp, err := os.CreateTemp(dir, "entry-*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), entryPath(dir, key))
+}
+
+func removeEntry(dir, key string) error {
+	err := os.Remove(entryPath(dir, key))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func readEntries(dir string) (map[string]CacheEntry, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]CacheEntry)
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), entryExt) {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		stored := diskEntry{}
+		if err := json.Unmarshal(data, &stored); err != nil {
+			// corrupted entries are useless, drop them.
+			os.Remove(path)
+			continue
+		}
+		if stored.RawSize == 0 && !stored.Compressed {
+			// written before sizes were recorded.
+			stored.RawSize = len(stored.Value)
+		}
+		entries[stored.Key] = CacheEntry{
+			value:      stored.Value,
+			compressed: stored.Compressed,
+			rawSize:    stored.RawSize,
+			createdAt:  stored.CreatedAt,
+			expiresAt:  stored.ExpiresAt,
+			validators: Validators{
+				ETag:         stored.ETag,
+				LastModified: stored.LastModified,
+			},
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDiskPersist(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewCache(time.Minute, WithDir(dir))
+	defer cache.Close()
+	cache.Add("key1", []byte("val1"))
+	reloaded := NewCache(time.Minute, WithDir(dir))
+	defer reloaded.Close()
+	actual, ok := reloaded.Get("key1")
+	if !ok {
+		t.Fatal("key1 not found after reload")
+	}
+	if string(actual) != "val1" {
+		t.Errorf("%s doesn't match val1", string(actual))
+	}
+}
+
+func TestDiskLoadSkipsStale(t *testing.T) {
+	dir := t.TempDir()
+	err := writeEntry(dir, "key1", CacheEntry{
+		value:     []byte("val1"),
+		createdAt: time.Now().UTC().Add(-time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := NewCache(time.Minute, WithDir(dir))
+	defer cache.Close()
+	if _, ok := cache.Get("key1"); ok {
+		t.Error("key1 should have been dropped on load")
+	}
+	if _, err := os.Stat(entryPath(dir, "key1")); !os.IsNotExist(err) {
+		t.Error("stale entry file should have been removed")
+	}
+}
+
+func TestDiskReap(t *testing.T) {
+	dir := t.TempDir()
+	interval := time.Millisecond * 10
+	cache := NewCache(interval, WithDir(dir))
+	defer cache.Close()
+	cache.Add("key1", []byte("val1"))
+	time.Sleep(interval * 3)
+	if _, err := os.Stat(entryPath(dir, "key1")); !os.IsNotExist(err) {
+		t.Error("reaped entry file should have been removed")
+	}
+}
+
+func TestDiskCompressed(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewCache(time.Minute, WithDir(dir), WithCompression())
+	defer cache.Close()
+	cache.Add("key1", []byte("val1"))
+	reloaded := NewCache(time.Minute, WithDir(dir))
+	defer reloaded.Close()
+	actual, ok := reloaded.Get("key1")
+	if !ok {
+		t.Fatal("key1 not found after reload")
+	}
+	if string(actual) != "val1" {
+		t.Errorf("%s doesn't match val1", string(actual))
+	}
+}
+
+func TestDiskDropsCorruptEntry(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewCache(time.Minute, WithDir(dir), WithCompression())
+	defer cache.Close()
+	cache.Add("key1", []byte("val1"))
+	entry := cache.cache["key1"]
+	entry.value = []byte("not gzip")
+	cache.cache["key1"] = entry
+	if _, ok := cache.Get("key1"); ok {
+		t.Fatal("a corrupt entry shouldn't be served")
+	}
+	if _, err := os.Stat(entryPath(dir, "key1")); !os.IsNotExist(err) {
+		t.Errorf("the corrupt entry should have been removed from disk, got %v", err)
+	}
+	reloaded := NewCache(time.Minute, WithDir(dir), WithCompression())
+	defer reloaded.Close()
+	if _, ok := reloaded.Peek("key1"); ok {
+		t.Error("the corrupt entry came back after a restart")
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket holding up to burst tokens, refilled at
+// rate tokens per second.
+type rateLimiter struct {
+	mux    sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a token is available or ctx is done and reports how
+// long it had to wait.
+func (l *rateLimiter) Wait(ctx context.Context) (time.Duration, error) {
+	l.mux.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	// take the token right away, going into debt if there is none so
+	// concurrent callers queue up behind each other.
+	l.tokens--
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mux.Unlock()
+	if delay == 0 {
+		return 0, nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return delay, nil
+	case <-ctx.Done():
+		// hand the token back, we never used it.
+		l.mux.Lock()
+		l.tokens++
+		l.mux.Unlock()
+		return 0, ctx.Err()
+	}
+}
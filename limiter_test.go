@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBurst(t *testing.T) {
+	limiter := newRateLimiter(50, 2)
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if _, err := limiter.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the burst covers the first two, the other two wait 20ms each.
+	if elapsed := time.Since(start); elapsed < 35*time.Millisecond {
+		t.Errorf("4 waits took %v, expected at least 40ms", elapsed)
+	}
+}
+
+func TestRateLimiterCancel(t *testing.T) {
+	limiter := newRateLimiter(1, 1)
+	if _, err := limiter.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := limiter.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a deadline error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("wait should have been cut short, took %v", elapsed)
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+// historyLimit is how many lines the history file keeps.
+const historyLimit = 1000
+
+// errLineInterrupted is returned by ReadLine when Ctrl-C discards the line.
+var errLineInterrupted = errors.New("line interrupted")
+
+// lineSource is where the REPL reads its commands from. ReadLine prints the
+// prompt and returns the next line, or io.EOF once the input ends.
+type lineSource interface {
+	ReadLine(prompt string) (string, error)
+}
+
+// scannerSource reads plain lines, e.g. from a pipe or a test.
+type scannerSource struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (s *scannerSource) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(s.out, prompt)
+	if !s.scanner.Scan() {
+		if err := s.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return s.scanner.Text(), nil
+}
+
+// lineEditor reads lines from a terminal with cursor movement, history and
+// tab completion. The terminal is only put in raw mode while a line is read,
+// so commands run with the usual signal handling.
+type lineEditor struct {
+	in  *bufio.Reader
+	out io.Writer
+	// fd is the terminal to switch to raw mode, -1 leaves the mode alone.
+	fd       int
+	mux      sync.Mutex
+	rawState *term.State
+	history  []string
+	// historyFile is where entered lines are appended, if set.
+	historyFile string
+	// complete returns the candidates for the last word of the text before
+	// the cursor.
+	complete func(before string) []string
+}
+
+func newLineEditor(in *os.File, out io.Writer, historyFile string) *lineEditor {
+	e := &lineEditor{
+		in:          bufio.NewReader(in),
+		out:         out,
+		fd:          int(in.Fd()),
+		historyFile: historyFile,
+	}
+	e.history = loadHistory(historyFile)
+	return e
+}
+
+func (e *lineEditor) ReadLine(prompt string) (string, error) {
+	if err := e.makeRaw(); err != nil {
+		return "", err
+	}
+	defer e.Restore()
+	line := []rune{}
+	cursor := 0
+	// browsing the history keeps whatever was typed so far at the end.
+	historyIndex := len(e.history)
+	pending := ""
+	redraw := func() {
+		fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(line))
+		if back := len(line) - cursor; back > 0 {
+			fmt.Fprintf(e.out, "\x1b[%dD", back)
+		}
+	}
+	setLine := func(text string) {
+		line = []rune(text)
+		cursor = len(line)
+	}
+	fmt.Fprint(e.out, prompt)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			if err == io.EOF && len(line) > 0 {
+				fmt.Fprint(e.out, "\r\n")
+				e.remember(string(line))
+				return string(line), nil
+			}
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			e.remember(string(line))
+			return string(line), nil
+		case 3: // Ctrl-C
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errLineInterrupted
+		case 4: // Ctrl-D
+			if len(line) == 0 {
+				return "", io.EOF
+			}
+			if cursor < len(line) {
+				line = append(line[:cursor], line[cursor+1:]...)
+			}
+		case 1: // Ctrl-A
+			cursor = 0
+		case 5: // Ctrl-E
+			cursor = len(line)
+		case 2: // Ctrl-B
+			if cursor > 0 {
+				cursor--
+			}
+		case 6: // Ctrl-F
+			if cursor < len(line) {
+				cursor++
+			}
+		case 11: // Ctrl-K
+			line = line[:cursor]
+		case 21: // Ctrl-U
+			line = line[cursor:]
+			cursor = 0
+		case 23: // Ctrl-W
+			start := cursor
+			for start > 0 && line[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && line[start-1] != ' ' {
+				start--
+			}
+			line = append(line[:start], line[cursor:]...)
+			cursor = start
+		case 8, 127: // backspace
+			if cursor > 0 {
+				line = append(line[:cursor-1], line[cursor:]...)
+				cursor--
+			}
+		case '\t':
+			inserted, candidates := e.completion(string(line[:cursor]))
+			if len(candidates) > 1 && inserted == "" {
+				fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+				fmt.Fprint(e.out, prompt)
+			}
+			tail := append([]rune(inserted), line[cursor:]...)
+			line = append(line[:cursor], tail...)
+			cursor += len([]rune(inserted))
+		case 27: // escape sequence
+			switch e.readEscape() {
+			case "A":
+				if historyIndex > 0 {
+					if historyIndex == len(e.history) {
+						pending = string(line)
+					}
+					historyIndex--
+					setLine(e.history[historyIndex])
+				}
+			case "B":
+				if historyIndex < len(e.history) {
+					historyIndex++
+					if historyIndex == len(e.history) {
+						setLine(pending)
+					} else {
+						setLine(e.history[historyIndex])
+					}
+				}
+			case "C":
+				if cursor < len(line) {
+					cursor++
+				}
+			case "D":
+				if cursor > 0 {
+					cursor--
+				}
+			case "H", "1~", "7~":
+				cursor = 0
+			case "F", "4~", "8~":
+				cursor = len(line)
+			case "3~":
+				if cursor < len(line) {
+					line = append(line[:cursor], line[cursor+1:]...)
+				}
+			}
+		default:
+			if r < ' ' {
+				continue
+			}
+			line = append(line[:cursor], append([]rune{r}, line[cursor:]...)...)
+			cursor++
+		}
+		redraw()
+	}
+}
+
+// readEscape reads the rest of an escape sequence like "\x1b[A" and returns
+// what follows the bracket, e.g. "A" or "3~".
+func (e *lineEditor) readEscape() string {
+	r, _, err := e.in.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return ""
+	}
+	sequence := []rune{}
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return ""
+		}
+		sequence = append(sequence, r)
+		if r < '0' || r > '9' {
+			return string(sequence)
+		}
+	}
+}
+
+// completion returns the text to insert at the cursor and the candidates it
+// was picked from. A single candidate is completed in full, several only up
+// to their common prefix.
+func (e *lineEditor) completion(before string) (string, []string) {
+	if e.complete == nil {
+		return "", nil
+	}
+	// candidates are lower case, like everything the commands see.
+	word := strings.ToLower(before[strings.LastIndex(before, " ")+1:])
+	candidates := e.complete(before)
+	if len(candidates) == 0 {
+		return "", nil
+	}
+	if len(candidates) == 1 {
+		return strings.TrimPrefix(candidates[0], word) + " ", candidates
+	}
+	prefix := candidates[0]
+	for _, candidate := range candidates[1:] {
+		for !strings.HasPrefix(candidate, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return strings.TrimPrefix(prefix, word), candidates
+}
+
+// remember adds line to the history, skipping blank lines and repeats.
+func (e *lineEditor) remember(line string) {
+	if isBlank(line) {
+		return
+	}
+	if len(e.history) > 0 && e.history[len(e.history)-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > historyLimit {
+		e.history = e.history[len(e.history)-historyLimit:]
+	}
+	if e.historyFile != "" {
+		// history is a convenience, failing to save it isn't worth a warning.
+		_ = appendHistory(e.historyFile, line)
+	}
+}
+
+func (e *lineEditor) makeRaw() error {
+	if e.fd < 0 {
+		return nil
+	}
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	state, err := term.MakeRaw(e.fd)
+	if err != nil {
+		return err
+	}
+	e.rawState = state
+	return nil
+}
+
+// Restore puts the terminal back in the mode it was in before ReadLine. It
+// is safe to call at any time, e.g. when the session ends mid line.
+func (e *lineEditor) Restore() {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	if e.rawState == nil {
+		return
+	}
+	_ = term.Restore(e.fd, e.rawState)
+	e.rawState = nil
+}
+
+func loadHistory(path string) []string {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	history := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(history) == 1 && history[0] == "" {
+		return nil
+	}
+	if len(history) > historyLimit {
+		history = history[len(history)-historyLimit:]
+		// keep the file from growing forever.
+		_ = os.WriteFile(path, []byte(strings.Join(history, "\n")+"\n"), 0o600)
+	}
+	return history
+}
+
+func appendHistory(path, line string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(file, line); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestEditor(input string, history ...string) *lineEditor {
+	return &lineEditor{
+		in:      bufio.NewReader(strings.NewReader(input)),
+		out:     io.Discard,
+		fd:      -1,
+		history: history,
+	}
+}
+
+func TestLineEditorEditing(t *testing.T) {
+	cases := []struct {
+		name     string
+		input    string
+		history  []string
+		expected string
+	}{
+		{
+			name:     "plain",
+			input:    "map\r",
+			expected: "map",
+		},
+		{
+			name:     "backspace",
+			input:    "mapp\x7f\r",
+			expected: "map",
+		},
+		{
+			name:     "insert after moving left",
+			input:    "catc pikachu\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\x1b[Dh\r",
+			expected: "catch pikachu",
+		},
+		{
+			name:     "start and end of line",
+			input:    "atch\x01c\x05 ditto\r",
+			expected: "catch ditto",
+		},
+		{
+			name:     "delete word",
+			input:    "catch pikachu\x17ditto\r",
+			expected: "catch ditto",
+		},
+		{
+			name:     "kill to end",
+			input:    "explore canalave\x01\x1b[C\x1b[C\x1b[C\x1b[C\x1b[C\x1b[C\x1b[C\x0b\r",
+			expected: "explore",
+		},
+		{
+			name:     "previous history entry",
+			input:    "\x1b[A\x1b[A\r",
+			history:  []string{"map", "mapb"},
+			expected: "map",
+		},
+		{
+			name:     "back to the typed line",
+			input:    "pok\x1b[A\x1b[B\r",
+			history:  []string{"map"},
+			expected: "pok",
+		},
+	}
+	for _, cs := range cases {
+		editor := newTestEditor(cs.input, cs.history...)
+		actual, err := editor.ReadLine(prompt)
+		if err != nil {
+			t.Errorf("%s: %v", cs.name, err)
+			continue
+		}
+		if actual != cs.expected {
+			t.Errorf("%s: %q does not equal %q", cs.name, actual, cs.expected)
+		}
+	}
+}
+
+func TestLineEditorControlKeys(t *testing.T) {
+	editor := newTestEditor("catch\x03\x04")
+	if _, err := editor.ReadLine(prompt); !errors.Is(err, errLineInterrupted) {
+		t.Errorf("expected Ctrl-C to interrupt the line, got %v", err)
+	}
+	if _, err := editor.ReadLine(prompt); err != io.EOF {
+		t.Errorf("expected Ctrl-D on an empty line to end the input, got %v", err)
+	}
+}
+
+func TestLineEditorCompletion(t *testing.T) {
+	config := &Config{caughtPokemon: map[string]Pokemon{"pikachu": {}, "pidgey": {}}}
+	repl := NewREPL(strings.NewReader(""), io.Discard, config)
+	cases := []struct {
+		input    string
+		expected string
+	}{
+		{
+			input:    "ins\tpik\t\r",
+			expected: "inspect pikachu ",
+		},
+		{
+			input:    "inspect pi\tk\t\r",
+			expected: "inspect pikachu ",
+		},
+		{
+			input:    "ma\t\r",
+			expected: "map",
+		},
+		{
+			input:    "zz\t\r",
+			expected: "zz",
+		},
+		{
+			input:    "INS\tPIK\t\r",
+			expected: "INSpect PIKachu ",
+		},
+	}
+	for _, cs := range cases {
+		editor := newTestEditor(cs.input)
+		editor.complete = repl.complete
+		actual, err := editor.ReadLine(prompt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual != cs.expected {
+			t.Errorf("%q does not equal %q", actual, cs.expected)
+		}
+	}
+}
+
+func TestComplete(t *testing.T) {
+	config := &Config{
+		caughtPokemon:  map[string]Pokemon{"pikachu": {}, "ditto": {}},
+		knownLocations: map[string]struct{}{"canalave-city-area": {}, "eterna-city-area": {}},
+	}
+	repl := NewREPL(strings.NewReader(""), io.Discard, config)
+	cases := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			input:    "ma",
+			expected: []string{"map", "mapb"},
+		},
+		{
+			input:    "inspect ",
+			expected: []string{"ditto", "pikachu"},
+		},
+		{
+			input:    "explore et",
+			expected: []string{"eterna-city-area"},
+		},
+		{
+			input:    "cache c",
+			expected: []string{"clear"},
+		},
+		{
+			input:    "inspect pikachu ",
+			expected: []string{},
+		},
+	}
+	for _, cs := range cases {
+		actual := repl.complete(cs.input)
+		if !reflect.DeepEqual(actual, cs.expected) {
+			t.Errorf("%q: %v does not equal %v", cs.input, actual, cs.expected)
+		}
+	}
+}
+
+func TestHistoryPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pokedex", "history")
+	editor := newTestEditor("map\r\rmap\rcatch ditto\r")
+	editor.historyFile = path
+	for i := 0; i < 4; i++ {
+		if _, err := editor.ReadLine(prompt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "map\ncatch ditto\n" {
+		t.Errorf("unexpected history file %q", data)
+	}
+	actual := loadHistory(path)
+	expected := []string{"map", "catch ditto"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("%v does not equal %v", actual, expected)
+	}
+}
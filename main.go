@@ -1,493 +1,190 @@
 package main
 
 import (
-	"bufio"
-	"encoding/json"
+	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
-	"log"
 	"math/rand"
-	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	cache "github.com/cristhianjhlcom/pokedex/internal"
+	"golang.org/x/term"
 )
 
-const baseURL = "https://pokeapi.co/api/v2"
-
 func main() {
+	offline := flag.Bool("offline", false, "never touch the network, only serve cached data")
+	staleWhileRevalidate := flag.Bool("stale-while-revalidate", false, "serve expired cached data right away and refresh it in the background")
+	baseURL := flag.String("base-url", envOr("POKEAPI_BASE_URL", defaultBaseURL), "PokeAPI base URL, also read from $POKEAPI_BASE_URL")
+	rateLimit := flag.Float64("rate-limit", 10, "maximum PokeAPI requests per second, 0 disables the limit")
+	rateBurst := flag.Int("rate-burst", 20, "number of PokeAPI requests allowed in a burst")
+	scriptPath := flag.String("f", "", "run the commands in this file instead of starting the interactive prompt")
+	seed := flag.Int64("seed", 1, "seed for the random numbers catch uses, the interactive prompt picks one at random unless it is set")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: pokedex [flags] [command [command flags] [args]]")
+		fmt.Fprintln(flag.CommandLine.Output(), "Without a command the interactive pokedex is started.")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	cacheOptions := []cache.Option{
+		cache.WithMaxBytes(64 << 20),
+		cache.WithCompression(),
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		cacheOptions = append(cacheOptions, cache.WithDir(filepath.Join(dir, "pokedex")))
+	}
+	client := NewClient(
+		WithBaseURL(*baseURL),
+		WithCacheInterval(time.Hour),
+		WithCacheOptions(cacheOptions...),
+		WithOffline(*offline),
+		WithStaleWhileRevalidate(*staleWhileRevalidate),
+		WithRateLimit(*rateLimit, *rateBurst),
+	)
 	config := Config{
-		pokeAPIClient: NewClient(time.Hour),
+		pokeAPIClient: client,
 		caughtPokemon: make(map[string]Pokemon),
 	}
-	scanner := bufio.NewScanner(os.Stdin)
-	for {
-		fmt.Print("pokedex > ")
-		scanner.Scan()
-		text := scanner.Text()
-		cleaned := cleanInput(text)
-		if len(cleaned) == 0 {
-			continue
+	if dir, err := os.UserConfigDir(); err == nil {
+		config.aliasFile = filepath.Join(dir, "pokedex", "aliases.json")
+		loaded, err := loadAliases(config.aliasFile)
+		if err != nil {
+			// the pokedex still works without them, just don't overwrite a
+			// file that may only need fixing.
+			for _, line := range strings.Split(err.Error(), "\n") {
+				fmt.Fprintf(os.Stderr, "warning: %s\n", line)
+			}
+			fmt.Fprintln(os.Stderr, "warning: changes to aliases won't be saved until the file is fixed")
+			config.aliasFile = ""
 		}
-		commandName := cleaned[0]
-		args := []string{}
-		if len(cleaned) > 1 {
-			args = cleaned[1:]
+		config.aliases = loaded
+	}
+	// SIGTERM ends the session, SIGINT only cancels the running command at
+	// the prompt but stops a script.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	defer stop()
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	// scripts and single commands are for CI and demos, their output
+	// shouldn't change from run to run.
+	interactive := flag.NArg() == 0 && *scriptPath == "" && isTerminal(os.Stdin)
+	if !interactive || flagSet("seed") {
+		config.random = rand.New(rand.NewSource(*seed))
+	}
+	var err error
+	if flag.NArg() > 0 {
+		repl := NewREPL(os.Stdin, os.Stdout, &config)
+		repl.interrupts = interrupts
+		err = repl.RunArgs(ctx, flag.Args())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, describeError(err))
 		}
-		availableCommands := getCommands()
-		command, ok := availableCommands[commandName]
-		if !ok {
-			fmt.Println("invalid command")
-			continue
+	} else if !interactive {
+		err = runScript(ctx, *scriptPath, &config, interrupts)
+	} else {
+		repl := NewREPL(os.Stdin, os.Stdout, &config)
+		repl.interrupts = interrupts
+		var editor *lineEditor
+		if isTerminal(os.Stdout) {
+			editor = newLineEditor(os.Stdin, os.Stdout, historyPath())
+			editor.complete = repl.complete
+			repl.source = editor
 		}
-		err := command.callback(&config, args...)
-		if err != nil {
-			fmt.Println(err)
+		err = repl.Run(ctx)
+		if editor != nil {
+			// a SIGTERM can end the session while a line is being read.
+			editor.Restore()
 		}
 	}
+	// flush and release everything before exiting, os.Exit skips defers.
+	client.Close()
+	os.Exit(exitCode(ctx, err))
 }
 
-type Config struct {
-	pokeAPIClient           Client
-	nextLocationAreaURL     *string
-	previousLocationAreaURL *string
-	caughtPokemon           map[string]Pokemon
-}
-
-type CLICommand struct {
-	name        string
-	description string
-	callback    func(*Config, ...string) error
-}
-
-type Pokemon struct {
-	Abilities []struct {
-		Ability struct {
-			Name string `json:"name"`
-			URL  string `json:"url"`
-		} `json:"ability"`
-		IsHidden bool `json:"is_hidden"`
-		Slot     int  `json:"slot"`
-	} `json:"abilities"`
-	BaseExperience int `json:"base_experience"`
-	Cries          struct {
-		Latest string `json:"latest"`
-		Legacy string `json:"legacy"`
-	} `json:"cries"`
-	Forms []struct {
-		Name string `json:"name"`
-		URL  string `json:"url"`
-	} `json:"forms"`
-	GameIndices []struct {
-		GameIndex int `json:"game_index"`
-		Version   struct {
-			Name string `json:"name"`
-			URL  string `json:"url"`
-		} `json:"version"`
-	} `json:"game_indices"`
-	Height                 int           `json:"height"`
-	HeldItems              []interface{} `json:"held_items"`
-	ID                     int           `json:"id"`
-	IsDefault              bool          `json:"is_default"`
-	LocationAreaEncounters string        `json:"location_area_encounters"`
-	Moves                  []struct {
-		Move struct {
-			Name string `json:"name"`
-			URL  string `json:"url"`
-		} `json:"move"`
-		VersionGroupDetails []struct {
-			LevelLearnedAt  int `json:"level_learned_at"`
-			MoveLearnMethod struct {
-				Name string `json:"name"`
-				URL  string `json:"url"`
-			} `json:"move_learn_method"`
-			VersionGroup struct {
-				Name string `json:"name"`
-				URL  string `json:"url"`
-			} `json:"version_group"`
-		} `json:"version_group_details"`
-	} `json:"moves"`
-	Name          string        `json:"name"`
-	Order         int           `json:"order"`
-	PastAbilities []interface{} `json:"past_abilities"`
-	PastTypes     []interface{} `json:"past_types"`
-	Species       struct {
-		Name string `json:"name"`
-		URL  string `json:"url"`
-	} `json:"species"`
-	Sprites struct {
-		BackDefault      string      `json:"back_default"`
-		BackFemale       interface{} `json:"back_female"`
-		BackShiny        string      `json:"back_shiny"`
-		BackShinyFemale  interface{} `json:"back_shiny_female"`
-		FrontDefault     string      `json:"front_default"`
-		FrontFemale      interface{} `json:"front_female"`
-		FrontShiny       string      `json:"front_shiny"`
-		FrontShinyFemale interface{} `json:"front_shiny_female"`
-		Other            struct {
-			DreamWorld struct {
-				FrontDefault string      `json:"front_default"`
-				FrontFemale  interface{} `json:"front_female"`
-			} `json:"dream_world"`
-			Home struct {
-				FrontDefault     string      `json:"front_default"`
-				FrontFemale      interface{} `json:"front_female"`
-				FrontShiny       string      `json:"front_shiny"`
-				FrontShinyFemale interface{} `json:"front_shiny_female"`
-			} `json:"home"`
-			OfficialArtwork struct {
-				FrontDefault string `json:"front_default"`
-				FrontShiny   string `json:"front_shiny"`
-			} `json:"official-artwork"`
-			Showdown struct {
-				BackDefault      string      `json:"back_default"`
-				BackFemale       interface{} `json:"back_female"`
-				BackShiny        string      `json:"back_shiny"`
-				BackShinyFemale  interface{} `json:"back_shiny_female"`
-				FrontDefault     string      `json:"front_default"`
-				FrontFemale      interface{} `json:"front_female"`
-				FrontShiny       string      `json:"front_shiny"`
-				FrontShinyFemale interface{} `json:"front_shiny_female"`
-			} `json:"showdown"`
-		} `json:"other"`
-		Versions struct {
-			GenerationI struct {
-				RedBlue struct {
-					BackDefault      string `json:"back_default"`
-					BackGray         string `json:"back_gray"`
-					BackTransparent  string `json:"back_transparent"`
-					FrontDefault     string `json:"front_default"`
-					FrontGray        string `json:"front_gray"`
-					FrontTransparent string `json:"front_transparent"`
-				} `json:"red-blue"`
-				Yellow struct {
-					BackDefault      string `json:"back_default"`
-					BackGray         string `json:"back_gray"`
-					BackTransparent  string `json:"back_transparent"`
-					FrontDefault     string `json:"front_default"`
-					FrontGray        string `json:"front_gray"`
-					FrontTransparent string `json:"front_transparent"`
-				} `json:"yellow"`
-			} `json:"generation-i"`
-			GenerationIi struct {
-				Crystal struct {
-					BackDefault           string `json:"back_default"`
-					BackShiny             string `json:"back_shiny"`
-					BackShinyTransparent  string `json:"back_shiny_transparent"`
-					BackTransparent       string `json:"back_transparent"`
-					FrontDefault          string `json:"front_default"`
-					FrontShiny            string `json:"front_shiny"`
-					FrontShinyTransparent string `json:"front_shiny_transparent"`
-					FrontTransparent      string `json:"front_transparent"`
-				} `json:"crystal"`
-				Gold struct {
-					BackDefault      string `json:"back_default"`
-					BackShiny        string `json:"back_shiny"`
-					FrontDefault     string `json:"front_default"`
-					FrontShiny       string `json:"front_shiny"`
-					FrontTransparent string `json:"front_transparent"`
-				} `json:"gold"`
-				Silver struct {
-					BackDefault      string `json:"back_default"`
-					BackShiny        string `json:"back_shiny"`
-					FrontDefault     string `json:"front_default"`
-					FrontShiny       string `json:"front_shiny"`
-					FrontTransparent string `json:"front_transparent"`
-				} `json:"silver"`
-			} `json:"generation-ii"`
-			GenerationIii struct {
-				Emerald struct {
-					FrontDefault string `json:"front_default"`
-					FrontShiny   string `json:"front_shiny"`
-				} `json:"emerald"`
-				FireredLeafgreen struct {
-					BackDefault  string `json:"back_default"`
-					BackShiny    string `json:"back_shiny"`
-					FrontDefault string `json:"front_default"`
-					FrontShiny   string `json:"front_shiny"`
-				} `json:"firered-leafgreen"`
-				RubySapphire struct {
-					BackDefault  string `json:"back_default"`
-					BackShiny    string `json:"back_shiny"`
-					FrontDefault string `json:"front_default"`
-					FrontShiny   string `json:"front_shiny"`
-				} `json:"ruby-sapphire"`
-			} `json:"generation-iii"`
-			GenerationIv struct {
-				DiamondPearl struct {
-					BackDefault      string      `json:"back_default"`
-					BackFemale       interface{} `json:"back_female"`
-					BackShiny        string      `json:"back_shiny"`
-					BackShinyFemale  interface{} `json:"back_shiny_female"`
-					FrontDefault     string      `json:"front_default"`
-					FrontFemale      interface{} `json:"front_female"`
-					FrontShiny       string      `json:"front_shiny"`
-					FrontShinyFemale interface{} `json:"front_shiny_female"`
-				} `json:"diamond-pearl"`
-				HeartgoldSoulsilver struct {
-					BackDefault      string      `json:"back_default"`
-					BackFemale       interface{} `json:"back_female"`
-					BackShiny        string      `json:"back_shiny"`
-					BackShinyFemale  interface{} `json:"back_shiny_female"`
-					FrontDefault     string      `json:"front_default"`
-					FrontFemale      interface{} `json:"front_female"`
-					FrontShiny       string      `json:"front_shiny"`
-					FrontShinyFemale interface{} `json:"front_shiny_female"`
-				} `json:"heartgold-soulsilver"`
-				Platinum struct {
-					BackDefault      string      `json:"back_default"`
-					BackFemale       interface{} `json:"back_female"`
-					BackShiny        string      `json:"back_shiny"`
-					BackShinyFemale  interface{} `json:"back_shiny_female"`
-					FrontDefault     string      `json:"front_default"`
-					FrontFemale      interface{} `json:"front_female"`
-					FrontShiny       string      `json:"front_shiny"`
-					FrontShinyFemale interface{} `json:"front_shiny_female"`
-				} `json:"platinum"`
-			} `json:"generation-iv"`
-			GenerationV struct {
-				BlackWhite struct {
-					Animated struct {
-						BackDefault      string      `json:"back_default"`
-						BackFemale       interface{} `json:"back_female"`
-						BackShiny        string      `json:"back_shiny"`
-						BackShinyFemale  interface{} `json:"back_shiny_female"`
-						FrontDefault     string      `json:"front_default"`
-						FrontFemale      interface{} `json:"front_female"`
-						FrontShiny       string      `json:"front_shiny"`
-						FrontShinyFemale interface{} `json:"front_shiny_female"`
-					} `json:"animated"`
-					BackDefault      string      `json:"back_default"`
-					BackFemale       interface{} `json:"back_female"`
-					BackShiny        string      `json:"back_shiny"`
-					BackShinyFemale  interface{} `json:"back_shiny_female"`
-					FrontDefault     string      `json:"front_default"`
-					FrontFemale      interface{} `json:"front_female"`
-					FrontShiny       string      `json:"front_shiny"`
-					FrontShinyFemale interface{} `json:"front_shiny_female"`
-				} `json:"black-white"`
-			} `json:"generation-v"`
-			GenerationVi struct {
-				OmegarubyAlphasapphire struct {
-					FrontDefault     string      `json:"front_default"`
-					FrontFemale      interface{} `json:"front_female"`
-					FrontShiny       string      `json:"front_shiny"`
-					FrontShinyFemale interface{} `json:"front_shiny_female"`
-				} `json:"omegaruby-alphasapphire"`
-				XY struct {
-					FrontDefault     string      `json:"front_default"`
-					FrontFemale      interface{} `json:"front_female"`
-					FrontShiny       string      `json:"front_shiny"`
-					FrontShinyFemale interface{} `json:"front_shiny_female"`
-				} `json:"x-y"`
-			} `json:"generation-vi"`
-			GenerationVii struct {
-				Icons struct {
-					FrontDefault string      `json:"front_default"`
-					FrontFemale  interface{} `json:"front_female"`
-				} `json:"icons"`
-				UltraSunUltraMoon struct {
-					FrontDefault     string      `json:"front_default"`
-					FrontFemale      interface{} `json:"front_female"`
-					FrontShiny       string      `json:"front_shiny"`
-					FrontShinyFemale interface{} `json:"front_shiny_female"`
-				} `json:"ultra-sun-ultra-moon"`
-			} `json:"generation-vii"`
-			GenerationViii struct {
-				Icons struct {
-					FrontDefault string      `json:"front_default"`
-					FrontFemale  interface{} `json:"front_female"`
-				} `json:"icons"`
-			} `json:"generation-viii"`
-		} `json:"versions"`
-	} `json:"sprites"`
-	Stats []struct {
-		BaseStat int `json:"base_stat"`
-		Effort   int `json:"effort"`
-		Stat     struct {
-			Name string `json:"name"`
-			URL  string `json:"url"`
-		} `json:"stat"`
-	} `json:"stats"`
-	Types []struct {
-		Slot int `json:"slot"`
-		Type struct {
-			Name string `json:"name"`
-			URL  string `json:"url"`
-		} `json:"type"`
-	} `json:"types"`
-	Weight int `json:"weight"`
-}
-
-type Client struct {
-	cache      cache.Cache
-	httpClient http.Client
-}
-
-type LocationAreaResponse struct {
-	Count    int     `json:"count"`
-	Next     *string `json:"next"`
-	Previous *string `json:"previous"`
-	Results  []struct {
-		Name string `json:"name"`
-		URL  string `json:"url"`
-	} `json:"results"`
-}
-
-type LocationArea struct {
-	Areas []struct {
-		Name string `json:"name"`
-		URL  string `json:"url"`
-	} `json:"areas"`
-	GameIndices []struct {
-		GameIndex  int `json:"game_index"`
-		Generation struct {
-			Name string `json:"name"`
-			URL  string `json:"url"`
-		} `json:"generation"`
-	} `json:"game_indices"`
-	ID    int    `json:"id"`
-	Name  string `json:"name"`
-	Names []struct {
-		Language struct {
-			Name string `json:"name"`
-			URL  string `json:"url"`
-		} `json:"language"`
-		Name string `json:"name"`
-	} `json:"names"`
-	Region struct {
-		Name string `json:"name"`
-		URL  string `json:"url"`
-	} `json:"region"`
-}
-
-func NewClient(cacheInterval time.Duration) Client {
-	return Client{
-		cache: cache.NewCache(cacheInterval),
-		httpClient: http.Client{
-			Timeout: time.Minute,
-		},
-	}
-}
-
-func (c *Client) ListLocationAreas(pageURL *string) (LocationAreaResponse, error) {
-	endpoint := "/location/"
-	fullURL := baseURL + endpoint
-	if pageURL != nil {
-		fullURL = *pageURL
-	}
-	data, ok := c.cache.Get(fullURL)
-	if ok {
-		// cache hit.
-		locationAreasResponse := LocationAreaResponse{}
-		err := json.Unmarshal(data, &locationAreasResponse)
+// runScript runs the script at path, or the piped standard input if path
+// is empty.
+func runScript(ctx context.Context, path string, config *Config, interrupts <-chan os.Signal) error {
+	in := os.Stdin
+	if path != "" {
+		file, err := os.Open(path)
 		if err != nil {
-			return LocationAreaResponse{}, err
+			fmt.Fprintln(os.Stderr, err)
+			return err
 		}
-		return locationAreasResponse, nil
-	}
-	req, err := http.NewRequest("GET", fullURL, nil)
-	if err != nil {
-		return LocationAreaResponse{}, err
-	}
-	response, err := c.httpClient.Do(req)
-	if err != nil {
-		return LocationAreaResponse{}, err
+		defer file.Close()
+		in = file
 	}
-	defer response.Body.Close()
-	if response.StatusCode > 399 {
-		return LocationAreaResponse{}, fmt.Errorf("bad status code: %v", response.StatusCode)
-	}
-	data, err = io.ReadAll(response.Body)
-	if err != nil {
-		return LocationAreaResponse{}, err
-	}
-	locationAreasResponse := LocationAreaResponse{}
-	err = json.Unmarshal(data, &locationAreasResponse)
-	if err != nil {
-		return LocationAreaResponse{}, err
-	}
-	c.cache.Add(fullURL, data)
-	return locationAreasResponse, nil
+	repl := NewREPL(in, os.Stdout, config)
+	repl.interrupts = interrupts
+	return repl.RunScript(ctx)
 }
 
-func (c *Client) GetLocationArea(locationAreaName string) (LocationArea, error) {
-	endpoint := "/location/" + locationAreaName
-	fullURL := baseURL + endpoint
-	data, ok := c.cache.Get(fullURL)
-	if ok {
-		// cache hit.
-		locationArea := LocationArea{}
-		err := json.Unmarshal(data, &locationArea)
-		if err != nil {
-			return LocationArea{}, err
-		}
-		return locationArea, nil
-	}
-	req, err := http.NewRequest("GET", fullURL, nil)
-	if err != nil {
-		return LocationArea{}, err
-	}
-	response, err := c.httpClient.Do(req)
-	if err != nil {
-		return LocationArea{}, err
-	}
-	defer response.Body.Close()
-	if response.StatusCode > 399 {
-		return LocationArea{}, fmt.Errorf("bad status code: %v", response.StatusCode)
-	}
-	data, err = io.ReadAll(response.Body)
-	if err != nil {
-		return LocationArea{}, err
-	}
-	locationArea := LocationArea{}
-	err = json.Unmarshal(data, &locationArea)
+// historyPath is where the lines entered at the prompt are kept between
+// sessions, or "" if there is no place for it.
+func historyPath() string {
+	dir, err := os.UserConfigDir()
 	if err != nil {
-		return LocationArea{}, err
+		return ""
 	}
-	c.cache.Add(fullURL, data)
-	return locationArea, nil
+	return filepath.Join(dir, "pokedex", "history")
 }
 
-func (c *Client) GetPokemon(name string) (Pokemon, error) {
-	endpoint := "/pokemon/" + name
-	fullURL := baseURL + endpoint
-	data, ok := c.cache.Get(fullURL)
-	if ok {
-		// cache hit.
-		pokemon := Pokemon{}
-		err := json.Unmarshal(data, &pokemon)
-		if err != nil {
-			return Pokemon{}, err
+// flagSet reports whether the flag called name was given on the command
+// line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
 		}
-		return pokemon, nil
-	}
-	req, err := http.NewRequest("GET", fullURL, nil)
-	if err != nil {
-		return Pokemon{}, err
-	}
-	response, err := c.httpClient.Do(req)
-	if err != nil {
-		return Pokemon{}, err
-	}
-	defer response.Body.Close()
-	if response.StatusCode > 399 {
-		return Pokemon{}, fmt.Errorf("bad status code: %v", response.StatusCode)
-	}
-	data, err = io.ReadAll(response.Body)
-	if err != nil {
-		return Pokemon{}, err
-	}
-	pokemon := Pokemon{}
-	err = json.Unmarshal(data, &pokemon)
-	if err != nil {
-		return Pokemon{}, err
-	}
-	c.cache.Add(fullURL, data)
-	return pokemon, nil
+	})
+	return set
+}
+
+// isTerminal reports whether file is an interactive terminal, unlike other
+// character devices such as /dev/null.
+func isTerminal(file *os.File) bool {
+	return term.IsTerminal(int(file.Fd()))
+}
+
+func exitCode(ctx context.Context, err error) int {
+	switch {
+	case ctx.Err() != nil:
+		// the conventional status for being killed by SIGTERM.
+		return 128 + int(syscall.SIGTERM)
+	case errors.Is(err, errInterrupted):
+		return 128 + int(syscall.SIGINT)
+	case err != nil:
+		return 1
+	}
+	return 0
+}
+
+type Config struct {
+	pokeAPIClient           Client
+	nextLocationAreaURL     *string
+	previousLocationAreaURL *string
+	caughtPokemon           map[string]Pokemon
+	// knownLocations are the location areas listed by map so far, offered
+	// when completing explore.
+	knownLocations map[string]struct{}
+	aliases        aliases
+	// aliasFile is where changes to the aliases are saved, if set.
+	aliasFile string
+	// inspectUncaught lets inspect look up pokemon that weren't caught,
+	// for one-shot commands where nothing can have been caught.
+	inspectUncaught bool
+	out             io.Writer
+	random          *rand.Rand
 }
 
 func getCommands() map[string]CLICommand {
@@ -495,12 +192,22 @@ func getCommands() map[string]CLICommand {
 		"help": {
 			name:        "help",
 			description: "Prints the help menu",
-			callback:    callbackHelp,
+			args: []commandArg{
+				{name: "command", description: "the command to explain in detail", optional: true, complete: func(*Config) []string {
+					return commandNames(getCommands())
+				}},
+			},
+			examples: []string{"help", "help map"},
+			callback: callbackHelp,
 		},
 		"map": {
 			name:        "map",
 			description: "Lists some locations areas",
-			callback:    callbackMap,
+			flags: []commandFlag{
+				{name: "page", description: "jump to this page of location areas", kind: argNumber, set: setMapPage},
+			},
+			examples: []string{"map", "map --page 3"},
+			callback: callbackMap,
 		},
 		"mapb": {
 			name:        "mapb",
@@ -508,25 +215,58 @@ func getCommands() map[string]CLICommand {
 			callback:    callbackMapb,
 		},
 		"explore": {
-			name:        "explore {location_area}",
+			name:        "explore",
 			description: "List the areas in location",
-			callback:    callbackExplorer,
+			args: []commandArg{
+				{name: "location_area", description: "a location area listed by map", complete: knownLocationNames},
+			},
+			examples: []string{"explore canalave-city-area"},
+			callback: callbackExplorer,
 		},
 		"catch": {
-			name:        "catch {pokemon_name}",
+			name:        "catch",
 			description: "Attempt to catch a pokemon and add it to your pokedex",
-			callback:    callbackCatch,
+			args: []commandArg{
+				{name: "pokemon_name", description: "the pokemon to throw a pokeball at"},
+			},
+			examples: []string{"catch pikachu"},
+			callback: callbackCatch,
 		},
 		"inspect": {
-			name:        "inspect {pokemon_name}",
+			name:        "inspect",
 			description: "View information about caught pokemon",
-			callback:    callbackInspect,
+			args: []commandArg{
+				{name: "pokemon_name", description: "a pokemon in your pokedex", complete: caughtPokemonNames},
+			},
+			examples: []string{"inspect pikachu"},
+			callback: callbackInspect,
 		},
 		"pokedex": {
 			name:        "pokedex",
 			description: "View all the pokemon in the pokedex",
 			callback:    callbackPokedex,
 		},
+		"cache": {
+			name:        "cache",
+			description: "View cache statistics, inspect or clear cached entries",
+			args: []commandArg{
+				{name: "subcommand", description: "keys lists the cached keys, inspect shows an entry and clear removes one or all of them", optional: true, choices: []string{"keys", "inspect", "clear"}},
+				{name: "key", description: "a cached URL or a path like pokemon/pikachu", optional: true},
+			},
+			examples: []string{"cache", "cache inspect pokemon/pikachu", "cache clear"},
+			callback: callbackCache,
+		},
+		"alias": {
+			name:        "alias",
+			description: "List, add or remove aliases and macros",
+			args: []commandArg{
+				{name: "subcommand", description: "add defines an alias, remove deletes one, without it the aliases are listed", optional: true, choices: []string{"add", "remove"}},
+				{name: "name", description: "the name of the alias", optional: true, complete: aliasNames},
+				{name: "commands", description: "the commands the alias runs, separated by ;, using $1, $2... or $@ for its arguments", optional: true, variadic: true},
+			},
+			examples: []string{"alias", "alias add c catch", "alias add hunt explore $1; catch $2", "alias remove c"},
+			callback: callbackAlias,
+		},
 		"exit": {
 			name:        "exit",
 			description: "Turns off the pokedex",
@@ -535,118 +275,354 @@ func getCommands() map[string]CLICommand {
 	}
 }
 
-func callbackHelp(config *Config, args ...string) error {
-	fmt.Println("Welcome to the Pokedex help menu!")
-	fmt.Println("Here are you available commands: ")
+func callbackHelp(ctx context.Context, config *Config, args ...string) error {
 	availableCommands := getCommands()
-	for _, cmd := range availableCommands {
-		fmt.Printf(" - %s: %s\n", cmd.name, cmd.description)
+	if len(args) == 1 {
+		cmd, ok := availableCommands[args[0]]
+		if !ok {
+			return fmt.Errorf("there is no command called %q", args[0])
+		}
+		cmd.printHelp(config.out)
+		return nil
 	}
-	fmt.Println("")
+	fmt.Fprintln(config.out, "Welcome to the Pokedex help menu!")
+	fmt.Fprintln(config.out, "Here are you available commands: ")
+	for _, name := range commandNames(availableCommands) {
+		cmd := availableCommands[name]
+		fmt.Fprintf(config.out, " - %s: %s\n", cmd.usage(), cmd.description)
+	}
+	fmt.Fprintln(config.out, "Run help {command} for more about a command.")
+	fmt.Fprintln(config.out)
 	return nil
 }
 
-func callbackExit(config *Config, args ...string) error {
-	os.Exit(0)
-	return nil
+func callbackExit(ctx context.Context, config *Config, args ...string) error {
+	return errExit
 }
 
-func callbackExplorer(config *Config, args ...string) error {
-	if len(args) != 1 {
-		return errors.New("No location area provided")
-	}
+func callbackExplorer(ctx context.Context, config *Config, args ...string) error {
 	locationArea := args[0]
-	response, err := config.pokeAPIClient.GetLocationArea(locationArea)
-	if err != nil {
-		log.Fatal(err)
+	response, err := config.pokeAPIClient.GetLocationAreaContext(ctx, locationArea)
+	if err != nil && !warnStale(config.out, err) {
 		return err
 	}
-	fmt.Printf("Areas in %s \n", locationArea)
+	fmt.Fprintf(config.out, "Areas in %s \n", locationArea)
 	for _, area := range response.Areas {
-		fmt.Printf(" - %s\n", area.Name)
+		fmt.Fprintf(config.out, " - %s\n", area.Name)
 	}
 	return nil
 }
 
-func callbackCatch(config *Config, args ...string) error {
-	if len(args) != 1 {
-		return errors.New("No pokemon name provided")
-	}
+func callbackCatch(ctx context.Context, config *Config, args ...string) error {
 	pokemonName := args[0]
-	response, err := config.pokeAPIClient.GetPokemon(pokemonName)
-	if err != nil {
-		log.Fatal(err)
+	response, err := config.pokeAPIClient.GetPokemonContext(ctx, pokemonName)
+	if err != nil && !warnStale(config.out, err) {
 		return err
 	}
 	const threshold = 50
-	randomNumber := rand.Intn(response.BaseExperience)
-	fmt.Println(response.BaseExperience, randomNumber, threshold)
+	// PokeAPI has no base experience for some pokemon, those are always
+	// caught.
+	randomNumber := config.random.Intn(max(response.BaseExperience, 1))
+	fmt.Fprintln(config.out, response.BaseExperience, randomNumber, threshold)
 	if randomNumber > threshold {
-		return fmt.Errorf("Failed to catch %s!\n", pokemonName)
+		return fmt.Errorf("Failed to catch %s!", pokemonName)
 	}
 	config.caughtPokemon[pokemonName] = response
-	fmt.Printf("%s was caught!\n", pokemonName)
+	fmt.Fprintf(config.out, "%s was caught!\n", pokemonName)
 	return nil
 }
 
-func callbackInspect(config *Config, args ...string) error {
-	if len(args) != 1 {
-		return errors.New("No pokemon name provided")
-	}
+func callbackInspect(ctx context.Context, config *Config, args ...string) error {
 	pokemonName := args[0]
 	pokemon, ok := config.caughtPokemon[pokemonName]
+	if !ok && !config.inspectUncaught {
+		return withSuggestions(errors.New("you haven't caught this pokemon yet"), pokemonName, caughtPokemonNames(config))
+	}
 	if !ok {
-		return errors.New("you haven't caught this pokemon yet")
+		var err error
+		pokemon, err = config.pokeAPIClient.GetPokemonContext(ctx, pokemonName)
+		if err != nil && !warnStale(config.out, err) {
+			return err
+		}
 	}
-	fmt.Printf("Name: %s", pokemon.Name)
-	fmt.Printf("Height: %v", pokemon.Height)
-	fmt.Printf("Weight: %v", pokemon.Weight)
+	fmt.Fprintf(config.out, "Name: %s\n", pokemon.Name)
+	fmt.Fprintf(config.out, "Height: %v\n", pokemon.Height)
+	fmt.Fprintf(config.out, "Weight: %v\n", pokemon.Weight)
 	return nil
 }
 
-func callbackPokedex(config *Config, args ...string) error {
-	fmt.Println("Pokemon in Pokedex")
-	for _, pokemon := range config.caughtPokemon {
-		fmt.Printf("Name: %s", pokemon.Name)
-		fmt.Printf("Height: %v", pokemon.Height)
-		fmt.Printf("Weight: %v", pokemon.Weight)
+func callbackPokedex(ctx context.Context, config *Config, args ...string) error {
+	fmt.Fprintln(config.out, "Pokemon in Pokedex")
+	names := caughtPokemonNames(config)
+	sort.Strings(names)
+	for _, name := range names {
+		pokemon := config.caughtPokemon[name]
+		fmt.Fprintf(config.out, "Name: %s\n", pokemon.Name)
+		fmt.Fprintf(config.out, "Height: %v\n", pokemon.Height)
+		fmt.Fprintf(config.out, "Weight: %v\n", pokemon.Weight)
 	}
 	return nil
 }
 
-func callbackMap(config *Config, args ...string) error {
-	response, err := config.pokeAPIClient.ListLocationAreas(config.nextLocationAreaURL)
-	if err != nil {
-		log.Fatal(err)
+func callbackMap(ctx context.Context, config *Config, args ...string) error {
+	response, err := config.pokeAPIClient.ListLocationAreasContext(ctx, config.nextLocationAreaURL)
+	if err != nil && !warnStale(config.out, err) {
 		return err
 	}
-	fmt.Println("Location areas")
+	fmt.Fprintln(config.out, "Location areas")
 	for _, area := range response.Results {
-		fmt.Printf(" - %s\n", area.Name)
+		fmt.Fprintf(config.out, " - %s\n", area.Name)
+		config.knownLocations[area.Name] = struct{}{}
 	}
 	config.nextLocationAreaURL = response.Next
 	config.previousLocationAreaURL = response.Previous
 	return nil
 }
 
-func callbackMapb(config *Config, args ...string) error {
+// locationPageSize is how many location areas PokeAPI lists per page.
+const locationPageSize = 20
+
+func setMapPage(config *Config, value string) error {
+	page, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	pageURL := fmt.Sprintf("%s/location/?offset=%d&limit=%d",
+		config.pokeAPIClient.baseURL,
+		(page-1)*locationPageSize,
+		locationPageSize,
+	)
+	config.nextLocationAreaURL = &pageURL
+	return nil
+}
+
+func knownLocationNames(config *Config) []string {
+	names := make([]string, 0, len(config.knownLocations))
+	for name := range config.knownLocations {
+		names = append(names, name)
+	}
+	return names
+}
+
+func caughtPokemonNames(config *Config) []string {
+	names := make([]string, 0, len(config.caughtPokemon))
+	for name := range config.caughtPokemon {
+		names = append(names, name)
+	}
+	return names
+}
+
+func callbackMapb(ctx context.Context, config *Config, args ...string) error {
 	if config.previousLocationAreaURL == nil {
 		return errors.New("You are on the first page")
 	}
-	response, err := config.pokeAPIClient.ListLocationAreas(config.previousLocationAreaURL)
-	if err != nil {
-		log.Fatal(err)
+	response, err := config.pokeAPIClient.ListLocationAreasContext(ctx, config.previousLocationAreaURL)
+	if err != nil && !warnStale(config.out, err) {
 		return err
 	}
-	fmt.Println("Location areas")
+	fmt.Fprintln(config.out, "Location areas")
 	for _, area := range response.Results {
-		fmt.Printf(" - %s\n", area.Name)
+		fmt.Fprintf(config.out, " - %s\n", area.Name)
+		config.knownLocations[area.Name] = struct{}{}
 	}
 	config.nextLocationAreaURL = response.Next
 	config.previousLocationAreaURL = response.Previous
 	return nil
 }
 
+func callbackCache(ctx context.Context, config *Config, args ...string) error {
+	c := config.pokeAPIClient.cache
+	if len(args) == 0 {
+		stats := c.Stats()
+		fmt.Fprintln(config.out, "Cache statistics")
+		fmt.Fprintf(config.out, " - entries: %d\n", stats.Entries)
+		fmt.Fprintf(config.out, " - bytes: %d (%d uncompressed, ratio %.2f)\n", stats.Bytes, stats.RawBytes, stats.CompressionRatio())
+		fmt.Fprintf(config.out, " - hits: %d\n", stats.Hits)
+		fmt.Fprintf(config.out, " - misses: %d\n", stats.Misses)
+		fmt.Fprintf(config.out, " - adds: %d\n", stats.Adds)
+		fmt.Fprintf(config.out, " - refreshes: %d\n", stats.Refreshes)
+		fmt.Fprintf(config.out, " - reaped: %d\n", stats.Reaped)
+		fmt.Fprintf(config.out, " - evictions: %d\n", stats.Evictions)
+		clientStats := config.pokeAPIClient.Stats()
+		fmt.Fprintln(config.out, "Network statistics")
+		fmt.Fprintf(config.out, " - requests: %d\n", clientStats.Requests)
+		fmt.Fprintf(config.out, " - retries: %d\n", clientStats.Retries)
+		fmt.Fprintf(config.out, " - throttled: %d (%v)\n", clientStats.Throttled, clientStats.ThrottledTime)
+		return nil
+	}
+	switch args[0] {
+	case "keys":
+		browser, ok := c.(cache.Browser)
+		if !ok {
+			return errors.New("this cache can't list its keys")
+		}
+		fmt.Fprintln(config.out, "Cached keys")
+		for _, key := range browser.Keys() {
+			fmt.Fprintf(config.out, " - %s\n", key)
+		}
+		return nil
+	case "inspect":
+		if len(args) != 2 {
+			return getCommands()["cache"].usageError("missing key")
+		}
+		key := cacheKey(config.pokeAPIClient.baseURL, args[1])
+		revalidator, ok := c.(cache.Revalidator)
+		if !ok {
+			return errors.New("this cache can't show its entries")
+		}
+		entry, ok := revalidator.Peek(key)
+		if !ok {
+			return fmt.Errorf("%s is not cached", key)
+		}
+		fmt.Fprintf(config.out, "Key: %s\n", key)
+		fmt.Fprintf(config.out, "Size: %d bytes\n", len(entry.Value()))
+		fmt.Fprintf(config.out, "Created: %s\n", entry.CreatedAt().Local().Format(time.RFC1123))
+		fmt.Fprintf(config.out, "Expires: %s\n", entry.ExpiresAt().Local().Format(time.RFC1123))
+		return nil
+	case "clear":
+		if len(args) == 1 {
+			browser, ok := c.(cache.Browser)
+			if !ok {
+				return errors.New("this cache can only remove single keys")
+			}
+			browser.Clear()
+			fmt.Fprintln(config.out, "Cache cleared")
+			return nil
+		}
+		key := cacheKey(config.pokeAPIClient.baseURL, args[1])
+		if !c.Delete(key) {
+			return fmt.Errorf("%s is not cached", key)
+		}
+		fmt.Fprintf(config.out, "%s removed from cache\n", key)
+		return nil
+	}
+	return nil
+}
+
+func callbackAlias(ctx context.Context, config *Config, args ...string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(config.out, "Aliases")
+		for _, name := range config.aliases.names() {
+			fmt.Fprintf(config.out, " - %s: %s\n", name, strings.Join(config.aliases[name], "; "))
+		}
+		return nil
+	}
+	if len(args) < 2 {
+		return getCommands()["alias"].usageError("missing name")
+	}
+	name := args[1]
+	switch args[0] {
+	case "add":
+		if len(args) < 3 {
+			return getCommands()["alias"].usageError("missing commands")
+		}
+		if err := config.aliases.add(name, strings.Join(args[2:], " ")); err != nil {
+			return err
+		}
+		fmt.Fprintf(config.out, "%s added\n", name)
+	case "remove":
+		if _, ok := config.aliases[name]; !ok {
+			return fmt.Errorf("there is no alias called %q", name)
+		}
+		delete(config.aliases, name)
+		fmt.Fprintf(config.out, "%s removed\n", name)
+	}
+	if config.aliasFile == "" {
+		return nil
+	}
+	return config.aliases.save(config.aliasFile)
+}
+
+func aliasNames(config *Config) []string {
+	return config.aliases.names()
+}
+
+// cacheKey accepts either a full URL or a path relative to the API root,
+// e.g. "pokemon/pikachu".
+func cacheKey(baseURL, key string) string {
+	if strings.HasPrefix(key, "http://") || strings.HasPrefix(key, "https://") {
+		return key
+	}
+	return baseURL + "/" + strings.TrimPrefix(key, "/")
+}
+
+// warnStale reports whether err only flags the response as stale, printing
+// a warning if so.
+func warnStale(out io.Writer, err error) bool {
+	var staleErr *StaleError
+	if !errors.As(err, &staleErr) {
+		return false
+	}
+	fmt.Fprintf(out, "warning: %v\n", staleErr)
+	return true
+}
+
+// describeError turns client errors into something a player can act on.
+func describeError(err error) string {
+	var suggestion *SuggestionError
+	if errors.As(err, &suggestion) {
+		return fmt.Sprintf("%s, did you mean %s?", describeError(suggestion.Err), strings.Join(suggestion.Suggestions, " or "))
+	}
+	var upstream *UpstreamError
+	var decodeErr *DecodeError
+	var urlErr *url.Error
+	switch {
+	case errors.Is(err, ErrNotFound) && errors.As(err, &upstream):
+		kind, name := resourceName(upstream.URL)
+		return fmt.Sprintf("there is no %s called %q", kind, name)
+	case errors.Is(err, ErrRateLimited) && errors.As(err, &upstream) && upstream.RetryAfter > 0:
+		return fmt.Sprintf("PokeAPI is rate limiting us, try again in %v", upstream.RetryAfter)
+	case errors.Is(err, ErrRateLimited):
+		return "PokeAPI is rate limiting us, try again in a moment"
+	case errors.As(err, &upstream):
+		return fmt.Sprintf("PokeAPI is having trouble (status %d), try again later", upstream.StatusCode)
+	case errors.As(err, &decodeErr):
+		return fmt.Sprintf("PokeAPI sent a response we couldn't read for %s", decodeErr.URL)
+	case errors.Is(err, ErrOffline):
+		return "that isn't cached and the pokedex is offline"
+	case errors.Is(err, context.Canceled):
+		return "cancelled"
+	case errors.As(err, &urlErr):
+		return fmt.Sprintf("couldn't reach PokeAPI: %v", urlErr.Err)
+	}
+	return err.Error()
+}
+
+// resourceName splits a PokeAPI resource URL like .../pokemon/pikachu into
+// its kind and name.
+func resourceName(rawURL string) (string, string) {
+	kind, name, ok := resourcePath(rawURL)
+	if !ok {
+		return "resource", name
+	}
+	kind = strings.ReplaceAll(kind, "-", " ")
+	if kind == "location" {
+		kind = "location area"
+	}
+	return kind, name
+}
+
+// resourcePath splits a PokeAPI resource URL like .../pokemon/pikachu into
+// the endpoint and the name as they appear in the URL.
+func resourcePath(rawURL string) (string, string, bool) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", rawURL, false
+	}
+	segments := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+	if len(segments) < 2 {
+		return "", parsed.Path, false
+	}
+	return segments[len(segments)-2], segments[len(segments)-1], true
+}
+
+func envOr(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
 func cleanInput(str string) []string {
 	lowered := strings.ToLower(str)
 	words := strings.Fields(lowered)
@@ -1,6 +1,11 @@
 package main
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
 
 func TestCleanInput(t *testing.T) {
 	cases := []struct {
@@ -30,3 +35,119 @@ func TestCleanInput(t *testing.T) {
 		}
 	}
 }
+
+func TestCacheKey(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected string
+	}{
+		{
+			input:    "pokemon/pikachu",
+			expected: defaultBaseURL + "/pokemon/pikachu",
+		},
+		{
+			input:    "/location/",
+			expected: defaultBaseURL + "/location/",
+		},
+		{
+			input:    "https://example.com/pokemon/ditto",
+			expected: "https://example.com/pokemon/ditto",
+		},
+	}
+	for _, cs := range cases {
+		actual := cacheKey(defaultBaseURL, cs.input)
+		if actual != cs.expected {
+			t.Errorf("%v does not equal %v", actual, cs.expected)
+		}
+	}
+}
+
+func TestDescribeError(t *testing.T) {
+	cases := []struct {
+		input    error
+		expected string
+	}{
+		{
+			input:    &UpstreamError{StatusCode: 404, URL: defaultBaseURL + "/pokemon/pikachuu"},
+			expected: `there is no pokemon called "pikachuu"`,
+		},
+		{
+			input:    &UpstreamError{StatusCode: 404, URL: defaultBaseURL + "/location/nowhere"},
+			expected: `there is no location area called "nowhere"`,
+		},
+		{
+			input:    &UpstreamError{StatusCode: 429, URL: defaultBaseURL + "/pokemon/ditto"},
+			expected: "PokeAPI is rate limiting us, try again in a moment",
+		},
+		{
+			input:    &UpstreamError{StatusCode: 429, URL: defaultBaseURL + "/pokemon/ditto", RetryAfter: time.Minute},
+			expected: "PokeAPI is rate limiting us, try again in 1m0s",
+		},
+		{
+			input:    &UpstreamError{StatusCode: 502, URL: defaultBaseURL + "/pokemon/ditto", Retries: 3},
+			expected: "PokeAPI is having trouble (status 502), try again later",
+		},
+		{
+			input:    &DecodeError{URL: defaultBaseURL + "/pokemon/ditto", Err: errors.New("bad json")},
+			expected: "PokeAPI sent a response we couldn't read for " + defaultBaseURL + "/pokemon/ditto",
+		},
+		{
+			input:    &SuggestionError{Err: &UpstreamError{StatusCode: 404, URL: defaultBaseURL + "/pokemon/pikachuu"}, Suggestions: []string{"pikachu"}},
+			expected: `there is no pokemon called "pikachuu", did you mean pikachu?`,
+		},
+		{
+			input:    &SuggestionError{Err: errInvalidCommand, Suggestions: []string{"map", "mapb"}},
+			expected: "invalid command, did you mean map or mapb?",
+		},
+		{
+			input:    context.Canceled,
+			expected: "cancelled",
+		},
+		{
+			input:    errors.New("No pokemon name provided"),
+			expected: "No pokemon name provided",
+		},
+	}
+	for _, cs := range cases {
+		actual := describeError(cs.input)
+		if actual != cs.expected {
+			t.Errorf("%v does not equal %v", actual, cs.expected)
+		}
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	cases := []struct {
+		ctx      context.Context
+		err      error
+		expected int
+	}{
+		{
+			ctx:      context.Background(),
+			expected: 0,
+		},
+		{
+			ctx:      context.Background(),
+			err:      errInvalidCommand,
+			expected: 1,
+		},
+		{
+			ctx:      context.Background(),
+			err:      errInterrupted,
+			expected: 130,
+		},
+		{
+			ctx:      cancelled,
+			err:      context.Canceled,
+			expected: 143,
+		},
+	}
+	for _, cs := range cases {
+		actual := exitCode(cs.ctx, cs.err)
+		if actual != cs.expected {
+			t.Errorf("%v: %v does not equal %v", cs.err, actual, cs.expected)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const prompt = "pokedex > "
+
+var (
+	errInvalidCommand = errors.New("invalid command")
+	// errExit is returned by the exit command to end the session.
+	errExit = errors.New("exit")
+	// errInterrupted is returned when an interrupt stops a script.
+	errInterrupted = errors.New("interrupted")
+)
+
+// REPL reads commands from in and writes everything, including the output
+// of the commands, to out.
+type REPL struct {
+	in     io.Reader
+	out    io.Writer
+	config *Config
+	// source reads the lines of an interactive session, by default plain
+	// lines from in.
+	source lineSource
+	// interrupts cancels the running command, or discards the current line
+	// at the prompt, instead of ending the session.
+	interrupts <-chan os.Signal
+}
+
+func NewREPL(in io.Reader, out io.Writer, config *Config) *REPL {
+	config.out = out
+	if config.random == nil {
+		config.random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	if config.caughtPokemon == nil {
+		config.caughtPokemon = make(map[string]Pokemon)
+	}
+	if config.aliases == nil {
+		config.aliases = aliases{}
+	}
+	if config.knownLocations == nil {
+		config.knownLocations = make(map[string]struct{})
+	}
+	return &REPL{
+		in:     in,
+		out:    out,
+		config: config,
+		source: &scannerSource{scanner: bufio.NewScanner(in), out: out},
+	}
+}
+
+// Run reads and runs commands until the input ends, exit is run or ctx is
+// done. It returns the error of the last command run, if it failed.
+func (r *REPL) Run(ctx context.Context) error {
+	lines, next := r.readLines()
+	defer close(next)
+	var lastErr error
+	for {
+		next <- struct{}{}
+		var line lineResult
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				fmt.Fprintln(r.out)
+				return ctx.Err()
+			case <-r.interrupts:
+				fmt.Fprint(r.out, "\n"+prompt)
+			case line = <-lines:
+				break wait
+			}
+		}
+		if errors.Is(line.err, errLineInterrupted) {
+			continue
+		}
+		if line.err == io.EOF {
+			fmt.Fprintln(r.out)
+			return lastErr
+		}
+		if line.err != nil {
+			return line.err
+		}
+		err := r.runInterruptible(ctx, func(ctx context.Context) error {
+			return runCommand(ctx, r.config, line.text)
+		})
+		if errors.Is(err, errExit) {
+			return lastErr
+		}
+		if err != nil {
+			fmt.Fprintln(r.out, describeError(err))
+		}
+		if !isBlank(line.text) {
+			lastErr = err
+		}
+	}
+}
+
+// ScriptError reports the line of a script a command failed on.
+type ScriptError struct {
+	Line int
+	Err  error
+}
+
+func (e *ScriptError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, describeError(e.Err))
+}
+
+func (e *ScriptError) Unwrap() error {
+	return e.Err
+}
+
+// RunScript runs the input as a script: no prompt is printed, lines
+// starting with # are comments and failures are reported with their line
+// number. "set -e" makes the first failing command stop the script, "set +e"
+// turns that off again. It returns the error of the last command run, or
+// errInterrupted if an interrupt stopped the script.
+func (r *REPL) RunScript(ctx context.Context) error {
+	// unlike at the prompt, an interrupt stops the whole script.
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-r.interrupts:
+			cancel(errInterrupted)
+		case <-done:
+		}
+	}()
+	scanner := bufio.NewScanner(r.in)
+	stopOnError := false
+	var lastErr error
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		switch line {
+		case "set -e":
+			stopOnError = true
+			continue
+		case "set +e":
+			stopOnError = false
+			continue
+		}
+		err := runCommand(ctx, r.config, line)
+		if errors.Is(err, errExit) {
+			return lastErr
+		}
+		lastErr = nil
+		if err != nil {
+			lastErr = &ScriptError{Line: lineNumber, Err: err}
+			fmt.Fprintln(r.out, lastErr)
+			if ctx.Err() != nil {
+				return context.Cause(ctx)
+			}
+			if stopOnError {
+				return lastErr
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return lastErr
+}
+
+// RunArgs runs a single command given as command line arguments, e.g.
+// []string{"map", "--page", "3"}. Errors are returned, not printed.
+func (r *REPL) RunArgs(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errInvalidCommand
+	}
+	// pokemon and location names are lower case, like in the REPL.
+	words := append([]string{strings.ToLower(args[0])}, args[1:]...)
+	// a single command can't reuse anything it would have caught.
+	r.config.inspectUncaught = true
+	err := r.runInterruptible(ctx, func(ctx context.Context) error {
+		return runWords(ctx, r.config, words)
+	})
+	if errors.Is(err, errExit) {
+		return nil
+	}
+	return err
+}
+
+// runInterruptible runs fn, cancelling it if an interrupt arrives before it
+// is done.
+func (r *REPL) runInterruptible(ctx context.Context, fn func(context.Context) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-r.interrupts:
+			cancel()
+		case <-done:
+		}
+	}()
+	return fn(ctx)
+}
+
+type lineResult struct {
+	text string
+	err  error
+}
+
+// readLines reads a line from the source each time a value is sent on next,
+// so that Run can wait for input and interrupts at the same time without
+// reading ahead while a command runs. Closing next stops it.
+func (r *REPL) readLines() (<-chan lineResult, chan<- struct{}) {
+	// buffered so the reader never blocks once Run stopped listening.
+	lines := make(chan lineResult, 1)
+	next := make(chan struct{})
+	go func() {
+		for range next {
+			text, err := r.source.ReadLine(prompt)
+			lines <- lineResult{text: text, err: err}
+		}
+	}()
+	return lines, next
+}
+
+// complete returns the completions for the last word of before, the text
+// in front of the cursor: command names first, then whatever the arguments
+// of the command offer.
+func (r *REPL) complete(before string) []string {
+	words := strings.Fields(strings.ToLower(before))
+	word := ""
+	if len(words) > 0 && !strings.HasSuffix(before, " ") {
+		word = words[len(words)-1]
+		words = words[:len(words)-1]
+	}
+	options := []string{}
+	if len(words) == 0 {
+		options = append(commandNames(getCommands()), r.config.aliases.names()...)
+	} else if command, ok := getCommands()[words[0]]; ok && len(words) <= len(command.args) {
+		arg := command.args[len(words)-1]
+		options = append(options, arg.choices...)
+		if arg.complete != nil {
+			options = append(options, arg.complete(r.config)...)
+		}
+	}
+	candidates := []string{}
+	for _, option := range options {
+		if strings.HasPrefix(option, word) {
+			candidates = append(candidates, option)
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+func isBlank(line string) bool {
+	return len(cleanInput(line)) == 0
+}
+
+// runCommand runs a single line of input. Errors are returned for the
+// caller to report, they never end the session.
+func runCommand(ctx context.Context, config *Config, line string) error {
+	return runWords(ctx, config, cleanInput(line))
+}
+
+// runWords expands the aliases in words, a command name and its arguments,
+// and runs the resulting commands, stopping at the first failing one.
+func runWords(ctx context.Context, config *Config, words []string) error {
+	if len(words) == 0 {
+		return nil
+	}
+	commands, err := config.aliases.expand(words)
+	if err != nil {
+		return err
+	}
+	for _, command := range commands {
+		if err := runNamedCommand(ctx, config, command[0], command[1:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runNamedCommand checks args against the command called name and runs it
+// with the remaining positional arguments.
+func runNamedCommand(ctx context.Context, config *Config, name string, args []string) error {
+	availableCommands := getCommands()
+	command, ok := availableCommands[name]
+	if !ok {
+		candidates := append(commandNames(availableCommands), config.aliases.names()...)
+		return withSuggestions(errInvalidCommand, name, candidates)
+	}
+	positional, err := command.parse(config, args)
+	if errors.Is(err, flag.ErrHelp) {
+		command.printHelp(config.out)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = command.callback(ctx, config, positional...)
+	return suggestResource(ctx, config, err)
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// newFakePokeAPI serves a tiny, fixed slice of PokeAPI.
+func newFakePokeAPI(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		root := "http://" + r.Host
+		switch r.URL.Path {
+		case "/location/":
+			if r.URL.Query().Get("offset") == "2" {
+				fmt.Fprintf(w, `{"count":3,"next":null,"previous":"%s/location/?offset=0&limit=2","results":[{"name":"eterna-city"}]}`, root)
+				return
+			}
+			fmt.Fprintf(w, `{"count":3,"next":"%s/location/?offset=2&limit=2","previous":null,"results":[{"name":"canalave-city"},{"name":"pastoria-city"}]}`, root)
+		case "/pokemon/":
+			w.Write([]byte(`{"count":3,"results":[{"name":"pikachu"},{"name":"pichu"},{"name":"mewtwo"}]}`))
+		case "/location/canalave-city":
+			w.Write([]byte(`{"name":"canalave-city","areas":[{"name":"canalave-city-area"}]}`))
+		case "/pokemon/pikachu":
+			w.Write([]byte(`{"name":"pikachu","base_experience":1,"height":4,"weight":60}`))
+		case "/pokemon/ditto":
+			w.Write([]byte(`{"name":"ditto","base_experience":null,"height":3,"weight":40}`))
+		case "/pokemon/mewtwo":
+			w.Write([]byte(`{"name":"mewtwo","base_experience":340,"height":20,"weight":1220}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestConfig(t *testing.T, server *httptest.Server) *Config {
+	t.Helper()
+	client := NewClient(WithBaseURL(server.URL), WithRetries(0, 0, 0))
+	t.Cleanup(func() { client.Close() })
+	return &Config{
+		pokeAPIClient: client,
+		random:        rand.New(rand.NewSource(1)),
+	}
+}
+
+func TestTranscripts(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no transcripts found")
+	}
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".txt")
+		t.Run(name, func(t *testing.T) {
+			in, err := os.Open(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer in.Close()
+			server := newFakePokeAPI(t)
+			out := bytes.Buffer{}
+			repl := NewREPL(in, &out, newTestConfig(t, server))
+			// the error of the last command is covered by the exit status
+			// tests, the transcript already shows it.
+			repl.Run(context.Background())
+			actual := strings.ReplaceAll(out.String(), server.URL, "http://pokeapi.test")
+
+			golden := strings.TrimSuffix(input, ".txt") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, []byte(actual), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual != string(expected) {
+				t.Errorf("transcript doesn't match %s:\n%s", golden, actual)
+			}
+		})
+	}
+}
+
+func TestHelpListsEveryCommand(t *testing.T) {
+	out := bytes.Buffer{}
+	repl := NewREPL(strings.NewReader("help\n"), &out, newTestConfig(t, newFakePokeAPI(t)))
+	if err := repl.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	last := -1
+	for _, name := range commandNames(getCommands()) {
+		cmd := getCommands()[name]
+		index := strings.Index(out.String(), " - "+cmd.usage()+": "+cmd.description)
+		if index < 0 {
+			t.Errorf("help doesn't mention %s", cmd.name)
+			continue
+		}
+		if index < last {
+			t.Errorf("help doesn't list %s in alphabetical order", cmd.name)
+		}
+		last = index
+	}
+}
+
+func TestCommandErrorsDontEndSession(t *testing.T) {
+	config := newTestConfig(t, newFakePokeAPI(t))
+	NewREPL(strings.NewReader(""), io.Discard, config)
+	ctx := context.Background()
+
+	if err := runCommand(ctx, config, "catch pikachu"); err != nil {
+		t.Fatal(err)
+	}
+	if err := runCommand(ctx, config, "catch pikachuu"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if err := runCommand(ctx, config, "explore nowhere"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if err := runCommand(ctx, config, "pokedx"); !errors.Is(err, errInvalidCommand) {
+		t.Errorf("expected errInvalidCommand, got %v", err)
+	}
+	if _, ok := config.caughtPokemon["pikachu"]; !ok {
+		t.Error("pikachu should still be in the pokedex")
+	}
+	if err := runCommand(ctx, config, "inspect pikachu"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRunReturnsLastCommandError(t *testing.T) {
+	cases := []struct {
+		input   string
+		failing bool
+	}{
+		{input: "catch missingno\ncatch pikachu\n", failing: false},
+		{input: "catch pikachu\ncatch missingno\n", failing: true},
+		{input: "catch missingno\n\n", failing: true},
+		{input: "catch missingno\nexit\ncatch pikachu\n", failing: true},
+		{input: "", failing: false},
+	}
+	for _, cs := range cases {
+		repl := NewREPL(strings.NewReader(cs.input), io.Discard, newTestConfig(t, newFakePokeAPI(t)))
+		err := repl.Run(context.Background())
+		if (err != nil) != cs.failing {
+			t.Errorf("%q: unexpected result %v", cs.input, err)
+		}
+	}
+}
+
+func TestInterruptCancelsCommand(t *testing.T) {
+	arrived := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	in, input := io.Pipe()
+	out := &syncBuffer{}
+	interrupts := make(chan os.Signal, 1)
+	repl := NewREPL(in, out, newTestConfig(t, server))
+	repl.interrupts = interrupts
+	result := make(chan error, 1)
+	go func() {
+		result <- repl.Run(context.Background())
+	}()
+
+	fmt.Fprintln(input, "catch slowpoke")
+	<-arrived
+	interrupts <- os.Interrupt
+	fmt.Fprintln(input, "help")
+	input.Close()
+	if err := <-result; err != nil {
+		t.Errorf("the session should have gone on after the interrupt, got %v", err)
+	}
+	if !strings.Contains(out.String(), "cancelled") {
+		t.Errorf("expected the command to be cancelled:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "Welcome to the Pokedex help menu!") {
+		t.Errorf("expected help to run after the interrupt:\n%s", out.String())
+	}
+}
+
+func TestTerminateEndsSession(t *testing.T) {
+	in, input := io.Pipe()
+	defer input.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	repl := NewREPL(in, io.Discard, newTestConfig(t, newFakePokeAPI(t)))
+	result := make(chan error, 1)
+	go func() {
+		result <- repl.Run(ctx)
+	}()
+	cancel()
+	if err := <-result; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the session to be cancelled, got %v", err)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe to read while the REPL writes to it.
+type syncBuffer struct {
+	mux sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.buf.String()
+}
+
+func TestRunScript(t *testing.T) {
+	script := `# catch what we can
+catch pikachu
+
+catch missingno
+  pokedex
+set -e
+catch mewtwo
+explore nowhere
+catch pikachu
+`
+	out := bytes.Buffer{}
+	repl := NewREPL(strings.NewReader(script), &out, newTestConfig(t, newFakePokeAPI(t)))
+	err := repl.RunScript(context.Background())
+	var scriptErr *ScriptError
+	if !errors.As(err, &scriptErr) || scriptErr.Line != 8 || !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected the script to stop on line 8, got %v", err)
+	}
+	expected := `1 0 50
+pikachu was caught!
+line 4: there is no pokemon called "missingno"
+Pokemon in Pokedex
+Name: pikachu
+Height: 4
+Weight: 60
+340 47 50
+mewtwo was caught!
+line 8: there is no location area called "nowhere"
+`
+	if out.String() != expected {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+}
+
+func TestRunScriptWithoutStopOnError(t *testing.T) {
+	script := "catch missingno\ncatch pikachu\n"
+	repl := NewREPL(strings.NewReader(script), io.Discard, newTestConfig(t, newFakePokeAPI(t)))
+	if err := repl.RunScript(context.Background()); err != nil {
+		t.Errorf("the last command succeeded, got %v", err)
+	}
+	if _, ok := repl.config.caughtPokemon["pikachu"]; !ok {
+		t.Error("the script should have gone on after the failure")
+	}
+}
+
+func TestRunScriptStopsOnInterrupt(t *testing.T) {
+	arrived := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	in, input := io.Pipe()
+	// unblocks the writer once the script stopped reading.
+	defer in.Close()
+	out := &syncBuffer{}
+	interrupts := make(chan os.Signal, 1)
+	repl := NewREPL(in, out, newTestConfig(t, server))
+	repl.interrupts = interrupts
+	result := make(chan error, 1)
+	go func() {
+		result <- repl.RunScript(context.Background())
+	}()
+
+	fmt.Fprintln(input, "catch slowpoke")
+	<-arrived
+	interrupts <- os.Interrupt
+	go func() {
+		fmt.Fprintln(input, "help")
+		input.Close()
+	}()
+	if err := <-result; !errors.Is(err, errInterrupted) {
+		t.Errorf("expected the script to be interrupted, got %v", err)
+	}
+	if strings.Contains(out.String(), "Welcome to the Pokedex help menu!") {
+		t.Errorf("the script should have stopped at the interrupt:\n%s", out.String())
+	}
+}
+
+func TestRunArgs(t *testing.T) {
+	cases := []struct {
+		args     []string
+		expected string
+		err      error
+	}{
+		{
+			args:     []string{"explore", "canalave-city"},
+			expected: "Areas in canalave-city \n - canalave-city-area\n",
+		},
+		{
+			args:     []string{"inspect", "Pikachu"},
+			expected: "Name: pikachu\nHeight: 4\nWeight: 60\n",
+		},
+		{
+			args:     []string{"map", "--page", "1"},
+			expected: "Location areas\n - canalave-city\n - pastoria-city\n",
+		},
+		{
+			args: []string{"catch", "missingno"},
+			err:  ErrNotFound,
+		},
+		{
+			args: []string{"pokedx"},
+			err:  errInvalidCommand,
+		},
+	}
+	for _, cs := range cases {
+		out := bytes.Buffer{}
+		repl := NewREPL(nil, &out, newTestConfig(t, newFakePokeAPI(t)))
+		err := repl.RunArgs(context.Background(), cs.args)
+		if !errors.Is(err, cs.err) {
+			t.Errorf("%v: expected %v, got %v", cs.args, cs.err, err)
+		}
+		if cs.err == nil && out.String() != cs.expected {
+			t.Errorf("%v: unexpected output:\n%s", cs.args, out.String())
+		}
+	}
+}
+
+func TestMapPageFlag(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		w.Write([]byte(`{"results":[]}`))
+	}))
+	defer server.Close()
+	repl := NewREPL(nil, io.Discard, newTestConfig(t, server))
+	if err := repl.RunArgs(context.Background(), []string{"map", "--page", "3"}); err != nil {
+		t.Fatal(err)
+	}
+	if query != "offset=40&limit=20" {
+		t.Errorf("%s doesn't match offset=40&limit=20", query)
+	}
+	if err := repl.RunArgs(context.Background(), []string{"map", "--page", "0"}); err == nil {
+		t.Error("expected an invalid page error")
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+// maxSuggestions is how many names a "did you mean" offers at most.
+const maxSuggestions = 3
+
+// suggest returns the candidates close enough to name to be what was meant,
+// closest first.
+func suggest(name string, candidates []string) []string {
+	// allow one typo in short names and roughly one in three letters in
+	// longer ones.
+	limit := max(1, len(name)/3)
+	type match struct {
+		name     string
+		distance int
+	}
+	matches := []match{}
+	for _, candidate := range candidates {
+		if candidate == name {
+			continue
+		}
+		if d := editDistance(name, candidate); d <= limit {
+			matches = append(matches, match{name: candidate, distance: d})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].name < matches[j].name
+	})
+	suggestions := []string{}
+	for i := 0; i < len(matches) && i < maxSuggestions; i++ {
+		suggestions = append(suggestions, matches[i].name)
+	}
+	return suggestions
+}
+
+// editDistance is the number of letters to insert, delete, replace or swap
+// with their neighbour to turn a into b.
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}
+
+// withSuggestions adds the closest candidates to err, if there are any.
+func withSuggestions(err error, name string, candidates []string) error {
+	suggestions := suggest(name, candidates)
+	if len(suggestions) == 0 {
+		return err
+	}
+	return &SuggestionError{Err: err, Suggestions: suggestions}
+}
+
+// suggestResource adds the pokemon or location areas PokeAPI does know to
+// a not found error for a mistyped name.
+func suggestResource(ctx context.Context, config *Config, err error) error {
+	var upstream *UpstreamError
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &upstream) || ctx.Err() != nil {
+		return err
+	}
+	kind, name, ok := resourcePath(upstream.URL)
+	if !ok || (kind != "pokemon" && kind != "location") {
+		return err
+	}
+	names, indexErr := config.pokeAPIClient.NamesContext(ctx, kind)
+	if indexErr != nil {
+		// suggestions are a nicety, the original error is what matters.
+		return err
+	}
+	return withSuggestions(err, name, names)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	cases := []struct {
+		a        string
+		b        string
+		expected int
+	}{
+		{a: "pikachu", b: "pikachu", expected: 0},
+		{a: "pikachuu", b: "pikachu", expected: 1},
+		{a: "pikahcu", b: "pikachu", expected: 1},
+		{a: "mpa", b: "map", expected: 1},
+		{a: "", b: "map", expected: 3},
+		{a: "kitten", b: "sitting", expected: 3},
+	}
+	for _, cs := range cases {
+		actual := editDistance(cs.a, cs.b)
+		if actual != cs.expected {
+			t.Errorf("%s, %s: %v does not equal %v", cs.a, cs.b, actual, cs.expected)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	commands := commandNames(getCommands())
+	pokemon := []string{"pikachu", "pichu", "raichu", "mewtwo", "mew"}
+	cases := []struct {
+		name       string
+		candidates []string
+		expected   []string
+	}{
+		{
+			name:       "pokedx",
+			candidates: commands,
+			expected:   []string{"pokedex"},
+		},
+		{
+			name:       "mapp",
+			candidates: commands,
+			expected:   []string{"map", "mapb"},
+		},
+		{
+			name:       "pikchu",
+			candidates: pokemon,
+			expected:   []string{"pichu", "pikachu"},
+		},
+		{
+			name:       "mewtoo",
+			candidates: pokemon,
+			expected:   []string{"mewtwo"},
+		},
+		{
+			name:       "missingno",
+			candidates: pokemon,
+			expected:   []string{},
+		},
+	}
+	for _, cs := range cases {
+		actual := suggest(cs.name, cs.candidates)
+		if !reflect.DeepEqual(actual, cs.expected) {
+			t.Errorf("%s: %v does not equal %v", cs.name, actual, cs.expected)
+		}
+	}
+}